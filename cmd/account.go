@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/Mayowa-Ojo/otter/internal"
+)
+
+// GetRateLimit - fetch the remaining api request budget for the account
+// [token] - access token
+func GetRateLimit(token string) (int, error) {
+	client := internal.NewAPIClient(token)
+
+	resp, err := client.Do("GET", "/account/rate-limits", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		if resp.StatusCode == 401 {
+			return 0, errors.New("client is not authorized")
+		}
+		return 0, errors.New("error fetching resource")
+	}
+
+	var data struct {
+		Remaining int `json:"remaining"`
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		return 0, err
+	}
+
+	return data.Remaining, nil
+}
+
+// Account - heroku account of the access token
+type Account struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// GetAccount - fetch the account the access token belongs to
+// [token] - access token
+func GetAccount(token string) (*Account, error) {
+	client := internal.NewAPIClient(token)
+
+	resp, err := client.Do("GET", "/account", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		if resp.StatusCode == 401 {
+			return nil, errors.New("client is not authorized")
+		}
+		return nil, errors.New("error fetching resource")
+	}
+
+	var account Account
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &account); err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
@@ -1,68 +1,415 @@
 package cmd
 
 import (
-	"encoding/json"
+	"bufio"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Mayowa-Ojo/otter/internal"
 )
 
-// AuthorizeClient - grant client access via heroku oauth
-func AuthorizeClient() error {
-	// url := fmt.Sprintf("http://localhost:5000/auth")
-	url := fmt.Sprintf("https://otter-api-server.herokuapp.com/auth")
-	timeout := time.NewTimer(30 * time.Second)
+// openURLLink - swapped out in tests to stand in for the browser
+var openURLLink = internal.OpenURLLink
 
-	if err := internal.OpenURLLink(url); err != nil {
+// authTimeout - how long a login waits for the browser to come back
+var authTimeout = 2 * time.Minute
+
+// headlessTimeout - how long a headless login waits for the user, as long as the relay keeps the session
+var headlessTimeout = 10 * time.Minute
+
+// pollInterval - how often a headless login asks the relay for its tokens
+var pollInterval = 2 * time.Second
+
+// callbackGrace - how long the callback server stays up after the relay handed over the tokens,
+// so the browser's redirect still lands on it rather than a refused connection
+var callbackGrace = 5 * time.Second
+
+// callbackHandler - handles a request to the login callback, done is false to keep waiting for another one
+type callbackHandler func(w http.ResponseWriter, r *http.Request) (done bool, err error)
+
+// AuthorizeClient - grant client access via heroku oauth through the otter relay. The relay keeps
+// the tokens for a one-time session secret only this process knows: once the user has authorized otter,
+// the browser is sent to the callback server, which collects them. The relay is polled as well,
+// for browsers that can't reach this machine.
+// [addr] - bind address of the callback server, port 0 picks a free port
+// [scopes] - oauth scopes to ask for
+func AuthorizeClient(addr string, scopes []string) error {
+	secret, id, err := internal.NewLoginSession()
+	if err != nil {
 		return err
 	}
 
-	shutdownChan := make(chan string)
+	var mu sync.Mutex
+	collected := false
+	var lastErr error
+
+	// collect - ask the relay for the tokens, true once they're saved. Only a rejected session
+	// ends the login, other errors are retried on the next poll.
+	collect := func() (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if collected {
+			return true, nil
+		}
 
-	callbackHandler := func(w http.ResponseWriter, r *http.Request) {
-		var body map[string]interface{}
-		b, err := ioutil.ReadAll(r.Body)
+		tokens, err := internal.PollLoginSession(secret)
+		if err != nil && !errors.Is(err, internal.ErrLoginRejected) {
+			lastErr = err
+			return false, nil
+		}
+
+		if err != nil || tokens == nil {
+			return false, err
+		}
+
+		collected = true
+		return true, nil
+	}
+
+	handle := func(w http.ResponseWriter, r *http.Request) (bool, error) {
+		done, err := collect()
 		if err != nil {
-			log.Fatal(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true, err
+		}
+
+		if !done {
+			http.Error(w, "authorization is still pending - finish logging in to heroku", http.StatusAccepted)
+			return false, nil
+		}
+
+		http.Redirect(w, r, internal.AuthURL()+"/auth/success", http.StatusFound)
+		return true, nil
+	}
+
+	authURL := func(callback string) string {
+		u, _ := url.Parse(callback)
+		return fmt.Sprintf("%s/auth?host=%s&port=%s&session=%s&scope=%s", internal.AuthURL(), url.QueryEscape(u.Hostname()), u.Port(), id, url.QueryEscape(strings.Join(scopes, " ")))
+	}
+
+	err = awaitCallback(addr, "GET", handle, authURL, collect)
+	if err != nil && !errors.Is(err, internal.ErrLoginRejected) && lastErr != nil {
+		return fmt.Errorf("%s - last error from the relay: %v", err.Error(), lastErr)
+	}
+
+	return err
+}
+
+// AuthorizeLocal - grant client access via heroku oauth without the otter relay. otter exchanges
+// the authorization code itself with a self-hosted client, PKCE and a state unique to this login.
+// [client] - oauth client whose registered callback url points at addr
+// [addr] - bind address of the callback server
+// [scopes] - oauth scopes to ask for
+func AuthorizeLocal(client *internal.OAuthClient, addr string, scopes []string) error {
+	pkce, err := internal.NewPKCE()
+	if err != nil {
+		return err
+	}
+
+	state, err := internal.NewState()
+	if err != nil {
+		return err
+	}
+
+	handle := func(w http.ResponseWriter, r *http.Request) (bool, error) {
+		query := r.URL.Query()
+
+		// a stray request must not end the login
+		if query.Get("state") != state {
+			http.Error(w, "authorization failed - state mismatch", http.StatusBadRequest)
+			return false, nil
 		}
 
-		if err = json.Unmarshal(b, &body); err != nil {
-			log.Fatal(err.Error())
+		var err error
+		switch {
+		case query.Get("error") != "":
+			err = fmt.Errorf("authorization denied - %s", query.Get("error"))
+		case query.Get("code") == "":
+			err = errors.New("authorization failed - missing code")
+		default:
+			// the redirect uri has to match the one the code was issued for
+			_, err = client.Exchange(query.Get("code"), "http://"+r.Host+r.URL.Path, pkce, scopes)
 		}
 
-		if _, ok := body["access_token"]; !ok {
-			log.Fatal(errors.New("missing credentials"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return true, err
 		}
 
-		if err := internal.PersistAuthorization(body["access_token"].(string), body["refresh_token"].(string)); err != nil {
-			log.Fatal(err.Error())
+		fmt.Fprintln(w, "You are now logged in to otter - you can close this window.")
+		return true, nil
+	}
+
+	authURL := func(callback string) string {
+		return client.AuthorizeURL(callback, state, pkce, scopes)
+	}
+
+	return awaitCallback(addr, "GET", handle, authURL, nil)
+}
+
+// AuthorizeHeadless - log in through the relay without a browser on this machine. The login url
+// is printed for the user to open anywhere, while otter polls the relay with a one-time session secret.
+// [scopes] - oauth scopes to ask for
+// [out] - where the login url is printed
+func AuthorizeHeadless(scopes []string, out io.Writer) error {
+	secret, id, err := internal.NewLoginSession()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Open this url in a browser on any machine and authorize otter:\n\n  %s/auth?session=%s&scope=%s\n\nWaiting for authorization...\n", internal.AuthURL(), id, url.QueryEscape(strings.Join(scopes, " ")))
+
+	var lastErr error
+	deadline := time.Now().Add(headlessTimeout)
+	for time.Now().Before(deadline) {
+		tokens, err := internal.PollLoginSession(secret)
+		if errors.Is(err, internal.ErrLoginRejected) {
+			return err
 		}
 
-		fmt.Println(w, "\nYou are now logged in \u2713")
-		shutdownChan <- "done"
-		timeout.Stop()
+		// the relay may be briefly unreachable, failing or rate limiting, keep asking
+		if err == nil && tokens != nil {
+			return nil
+		}
+
+		lastErr = err
+		time.Sleep(pollInterval)
+	}
+
+	if lastErr != nil {
+		return fmt.Errorf("timed out waiting for authorization - last error from the relay: %v", lastErr)
+	}
+
+	return errors.New("timed out waiting for authorization")
+}
+
+// AuthorizeLocalHeadless - log in with a self-hosted client without a browser on this machine.
+// The user opens the printed url elsewhere and pastes back the url their browser was redirected to,
+// which fails to load since nothing listens on that machine.
+// [client] - oauth client whose registered callback url points at addr
+// [addr] - address of the registered callback url
+// [scopes] - oauth scopes to ask for
+// [out] - where the login url and prompt are printed
+// [in] - where the redirect url or code is read from
+func AuthorizeLocalHeadless(client *internal.OAuthClient, addr string, scopes []string, out io.Writer, in io.Reader) error {
+	addr, err := internal.LoopbackAddress(addr)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(addr, ":0") {
+		return errors.New("a self-hosted client needs the fixed callback address it was registered with - set callback_address")
+	}
+
+	pkce, err := internal.NewPKCE()
+	if err != nil {
+		return err
 	}
 
+	state, err := internal.NewState()
+	if err != nil {
+		return err
+	}
+
+	redirectURI := "http://" + addr + "/auth/callback"
+
+	fmt.Fprintf(out, "Open this url in a browser on any machine and authorize otter:\n\n  %s\n\n", client.AuthorizeURL(redirectURI, state, pkce, scopes))
+	fmt.Fprint(out, "Your browser is then sent to a page that doesn't load - paste its url (or just the code) here: ")
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return errors.New("authorization failed - no code entered")
+	}
+
+	code := strings.TrimSpace(line)
+	if strings.Contains(code, "?") {
+		u, err := url.Parse(code)
+		if err != nil {
+			return errors.New("authorization failed - couldn't read the pasted url")
+		}
+
+		query := u.Query()
+		if query.Get("state") != state {
+			return errors.New("authorization failed - state mismatch")
+		}
+		if query.Get("error") != "" {
+			return fmt.Errorf("authorization denied - %s", query.Get("error"))
+		}
+
+		code = query.Get("code")
+	}
+
+	if code == "" {
+		return errors.New("authorization failed - missing code")
+	}
+
+	_, err = client.Exchange(code, redirectURI, pkce, scopes)
+	return err
+}
+
+// awaitCallback - open the login page and serve its callback until the login completes or times out.
+// The callback server is shut down on every path.
+// [addr] - bind address of the callback server
+// [method] - method the callback arrives with
+// [handle] - handles a callback request
+// [authURL] - login page for the actual callback url
+// [poll] - checked every pollInterval for a login completed elsewhere, nil when there's nothing to poll
+func awaitCallback(addr, method string, handle callbackHandler, authURL func(callback string) string, poll func() (bool, error)) error {
+	results := make(chan error, 1)
+
 	handlers := []internal.HTTPHandler{
 		{
-			Handler: callbackHandler,
-			Path:    "/auth/callback",
-			Method:  "POST",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if done, err := handle(w, r); done {
+					select {
+					case results <- err:
+					default:
+					}
+				}
+			},
+			Path:   "/auth/callback",
+			Method: method,
 		},
 	}
 
-	// kill the server after 30s if no response is recieved
-	go func(t *time.Timer, ch chan string) {
-		<-t.C
-		ch <- "done"
-	}(timeout, shutdownChan)
+	srv, err := internal.NewEphemeralServer(addr, handlers)
+	if err != nil {
+		return err
+	}
+
+	defer srv.Shutdown()
+
+	if err := openURLLink(authURL(srv.URL() + "/auth/callback")); err != nil {
+		return fmt.Errorf("couldn't open a browser (%s) - log in with otter auth --no-browser", err.Error())
+	}
+
+	timeout := time.NewTimer(authTimeout)
+	defer timeout.Stop()
+
+	var tick <-chan time.Time
+	if poll != nil {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-results:
+			return err
+		case <-tick:
+			done, err := poll()
+			if err != nil {
+				return err
+			}
 
-	internal.EphemeralServer(shutdownChan, handlers)
+			if done {
+				// the browser is on its way to the callback, wait for it before shutting the server down
+				grace := time.NewTimer(callbackGrace)
+				defer grace.Stop()
+
+				select {
+				case <-results:
+				case <-grace.C:
+				}
+
+				return nil
+			}
+		case <-timeout.C:
+			return errors.New("timed out waiting for authorization")
+		}
+	}
+}
+
+// AuthStatus - what otter auth status reports about the active credentials
+type AuthStatus struct {
+	Profile string
+	// Source - where the credentials came from, see the internal.SOURCE_ constants
+	Source string
+	// Store - token store backend holding an otter login
+	Store     string
+	ExpiresAt time.Time
+	Scopes    []string
+	// Account - result of a live /account call, nil when it failed
+	Account *Account
+	// AccountErr - why the /account call failed
+	AccountErr error
+	// Latency - duration of the /account call
+	Latency time.Duration
+}
+
+// GetAuthStatus - inspect the credentials of the active profile and check them against the api
+func GetAuthStatus() (*AuthStatus, error) {
+	tokens, err := internal.GetAuthTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &AuthStatus{
+		Profile:   internal.ActiveProfile(),
+		Source:    tokens.Source,
+		ExpiresAt: tokens.ExpiresAt,
+		Scopes:    tokens.Scopes,
+	}
+
+	if tokens.Source == internal.SOURCE_LOGIN {
+		if store, err := internal.CurrentTokenStore(); err == nil {
+			status.Store = store.Name()
+		}
+	}
+
+	start := time.Now()
+	status.Account, status.AccountErr = GetAccount(tokens.AccessToken)
+	status.Latency = time.Since(start)
+
+	return status, nil
+}
+
+// authStatusOutput - status as shown by otter auth status --output
+func authStatusOutput(status *AuthStatus) *internal.Output {
+	out := &internal.Output{
+		Fields: []internal.Field{
+			{Name: "profile", Header: "Profile"},
+			{Name: "email", Header: "Email"},
+			{Name: "name", Header: "Name"},
+			{Name: "source", Header: "Source"},
+			{Name: "store", Header: "Store"},
+			{Name: "expires_at", Header: "Token expiry"},
+			{Name: "scopes", Header: "Scopes"},
+			{Name: "api", Header: "API"},
+			{Name: "latency_ms", Header: "Latency (ms)"},
+		},
+		Single: true,
+	}
+
+	var email, name, expiresAt, store interface{}
+	if status.Account != nil {
+		email, name = status.Account.Email, status.Account.Name
+	}
+	if !status.ExpiresAt.IsZero() {
+		expiresAt = status.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if status.Store != "" {
+		store = status.Store
+	}
+
+	api := "ok"
+	if status.AccountErr != nil {
+		api = "failed - " + status.AccountErr.Error()
+	}
+
+	scopes := status.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
 
-	return nil
+	out.Add(status.Profile, email, name, status.Source, store, expiresAt, scopes, api, status.Latency.Milliseconds())
+	return out
 }
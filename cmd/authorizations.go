@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Mayowa-Ojo/otter/internal"
+)
+
+// Authorization - heroku oauth authorization
+type Authorization struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Scope       []string `json:"scope"`
+	AccessToken *struct {
+		ID        string `json:"id"`
+		Token     string `json:"token"`
+		ExpiresIn *int   `json:"expires_in"`
+	} `json:"access_token"`
+	RefreshToken *struct {
+		Token string `json:"token"`
+	} `json:"refresh_token"`
+	Client *struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"client"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Token - access token of the authorization, empty when heroku didn't return it
+func (a *Authorization) Token() string {
+	if a.AccessToken == nil {
+		return ""
+	}
+
+	return a.AccessToken.Token
+}
+
+// ListAuthorizations - fetch every oauth authorization of the account
+// [token] - access token
+func ListAuthorizations(token string) ([]Authorization, error) {
+	var authorizations []Authorization
+
+	if err := internal.NewAPIClient(token).List("/oauth/authorizations", internal.ListRange{}, &authorizations); err != nil {
+		return nil, err
+	}
+
+	return authorizations, nil
+}
+
+// CreateAuthorization - create a long-lived authorization e.g. for a ci runner
+// [token] - access token
+// [scopes] - oauth scopes granted to the new token
+// [description] - what the token is used for
+func CreateAuthorization(token string, scopes []string, description string) (*Authorization, error) {
+	body := map[string]interface{}{
+		"scope": scopes,
+	}
+	if description != "" {
+		body["description"] = description
+	}
+
+	return authorizationRequest(token, "POST", "/oauth/authorizations", body, http.StatusCreated)
+}
+
+// GetAuthorization - fetch a single authorization
+// [token] - access token
+// [id] - authorization id
+func GetAuthorization(token, id string) (*Authorization, error) {
+	return authorizationRequest(token, "GET", fmt.Sprintf("/oauth/authorizations/%s", id), nil, http.StatusOK)
+}
+
+// RegenerateAuthorization - replace the tokens of an authorization, the old ones stop working.
+// Regenerating the authorization of the otter login saves the new tokens.
+// [token] - access token
+// [id] - authorization id
+func RegenerateAuthorization(token, id string) (*Authorization, error) {
+	current, err := GetAuthorization(token, id)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := authorizationRequest(token, "POST", fmt.Sprintf("/oauth/authorizations/%s/actions/regenerate-tokens", id), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Token() != "" && internal.IsLoginToken(current.Token()) && a.Token() != "" {
+		tokens := &internal.TokenPair{AccessToken: a.Token()}
+		if a.RefreshToken != nil {
+			tokens.RefreshToken = a.RefreshToken.Token
+		}
+		if a.AccessToken.ExpiresIn != nil {
+			tokens.ExpiresAt = internal.ExpiresAt(float64(*a.AccessToken.ExpiresIn))
+		}
+		tokens.Scopes = a.Scope
+		// regenerated tokens belong to the same client, refreshes keep going to it
+		if stored, err := internal.StoredTokens(); err == nil {
+			tokens.ClientID = stored.ClientID
+		}
+
+		if err := internal.PersistTokens(tokens); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// RevokeAuthorizationByID - revoke an authorization. The otter login is cleared only when
+// its own authorization was revoked successfully.
+// [token] - access token
+// [id] - authorization id
+func RevokeAuthorizationByID(token, id string) (*Authorization, error) {
+	current, err := GetAuthorization(token, id)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := authorizationRequest(token, "DELETE", fmt.Sprintf("/oauth/authorizations/%s", id), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Token() != "" && internal.IsLoginToken(current.Token()) {
+		if err := internal.ClearAuthorization(); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// authorizationRequest - send a request returning a single authorization
+// [status] - status code of a successful response
+func authorizationRequest(token, method, path string, body interface{}, status int) (*Authorization, error) {
+	client := internal.NewAPIClient(token)
+
+	resp, err := client.Do(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		switch resp.StatusCode {
+		case 401:
+			return nil, errors.New("client is not authorized")
+		case 404:
+			return nil, errors.New("authorization not found")
+		case 403:
+			return nil, errors.New("token isn't allowed to manage authorizations - log in with a global scope")
+		}
+		return nil, errors.New("error fetching resource")
+	}
+
+	var a Authorization
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// authorizationsOutput - authorizations as shown by otter auth tokens, the one of the otter login is current
+func authorizationsOutput(authorizations []Authorization) *internal.Output {
+	out := &internal.Output{Fields: []internal.Field{
+		{Name: "current", Header: "Current", Format: mark},
+		{Name: "id", Header: "ID"},
+		{Name: "description", Header: "Description", Wrap: true},
+		{Name: "scope", Header: "Scope"},
+		{Name: "client", Header: "Client"},
+		{Name: "created_at", Header: "Created"},
+	}, Empty: "No authorizations"}
+
+	for _, a := range authorizations {
+		client := ""
+		if a.Client != nil {
+			client = a.Client.Name
+		}
+
+		out.Add(a.Token() != "" && internal.IsLoginToken(a.Token()), a.ID, a.Description, a.Scope, client, a.CreatedAt)
+	}
+
+	return out
+}
+
+// authorizationOutput - details of a single authorization, including its token
+func authorizationOutput(a *Authorization) *internal.Output {
+	out := &internal.Output{Single: true, Fields: []internal.Field{
+		{Name: "id", Header: "ID"},
+		{Name: "description", Header: "Description"},
+		{Name: "scope", Header: "Scope"},
+		{Name: "client", Header: "Client"},
+		{Name: "token", Header: "Token"},
+		{Name: "expires_in", Header: "Expires in", Format: func(v interface{}) string {
+			if seconds, ok := v.(int); ok {
+				return (time.Duration(seconds) * time.Second).String()
+			}
+			return "never"
+		}},
+		{Name: "created_at", Header: "Created"},
+		{Name: "updated_at", Header: "Updated"},
+	}}
+
+	client := ""
+	if a.Client != nil {
+		client = a.Client.Name
+	}
+
+	var expiresIn interface{}
+	if a.AccessToken != nil && a.AccessToken.ExpiresIn != nil {
+		expiresIn = *a.AccessToken.ExpiresIn
+	}
+
+	out.Add(a.ID, a.Description, a.Scope, client, a.Token(), expiresIn, a.CreatedAt, a.UpdatedAt)
+
+	return out
+}
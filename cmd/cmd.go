@@ -1,18 +1,119 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/Mayowa-Ojo/otter/internal"
 	cli "github.com/urfave/cli/v2"
 )
 
+// settings - user settings loaded before any command runs
+var settings = &internal.Settings{}
+
+// stdout - where read commands write their output, progress and notes go to stderr
+var stdout io.Writer = os.Stdout
+
 // Execute - main entry to cli
 func Execute() *cli.App {
 	app := &cli.App{
 		Name:  "Escobar",
 		Usage: "Take control of your heroku deployments",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "debug",
+				Usage:   "trace http requests and responses to stderr, secrets are redacted",
+				EnvVars: []string{"OTTER_DEBUG"},
+			},
+			&cli.BoolFlag{
+				Name:  "debug-unsafe",
+				Usage: "same as --debug without redacting tokens and config var values",
+			},
+			&cli.StringFlag{
+				Name:    "ca-file",
+				Usage:   "pem bundle of extra root certificates e.g. for a corporate proxy",
+				EnvVars: []string{"OTTER_CA_FILE"},
+			},
+			&cli.DurationFlag{
+				Name:    "timeout",
+				Usage:   "timeout for each http request",
+				EnvVars: []string{"OTTER_TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "named profile whose tokens and defaults are used",
+				EnvVars: []string{"OTTER_PROFILE"},
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "output format of read commands - table, json, yaml, csv or tsv",
+				Value:   internal.OUTPUT_TABLE,
+				EnvVars: []string{"OTTER_OUTPUT"},
+			},
+			&cli.StringFlag{
+				Name:    "style",
+				Usage:   "table style - markdown, compact or borderless",
+				Value:   internal.STYLE_MARKDOWN,
+				EnvVars: []string{"OTTER_TABLE_STYLE"},
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "no spinners or notes on stderr, only output and errors",
+				EnvVars: []string{"OTTER_QUIET"},
+			},
+			&cli.BoolFlag{
+				Name:  "no-color",
+				Usage: "plain text without colors, also set by the NO_COLOR env var",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			internal.SetDebug(c.Bool("debug") || c.Bool("debug-unsafe"), c.Bool("debug-unsafe"))
+			internal.SetProgress(internal.ProgressSettings{
+				Quiet: c.Bool("quiet"),
+				// any value counts, see no-color.org
+				NoColor: c.Bool("no-color") || os.Getenv("NO_COLOR") != "",
+			})
+
+			s, err := internal.LoadSettings()
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			settings = s
+
+			profile := settings.Profile
+			if c.IsSet("profile") {
+				profile = c.String("profile")
+			}
+
+			if profile != "" {
+				if err := internal.SetProfile(profile); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+			}
+
+			if err := configureTransport(c); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			if err := internal.CheckOutputFormat(c.String("output")); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			if err := internal.CheckTableStyle(c.String("style")); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:    "auth",
@@ -24,33 +125,311 @@ func Execute() *cli.App {
 						Aliases: []string{"r"},
 						Usage:   "revoke your auth tokens",
 					},
+					&cli.StringFlag{
+						Name:    "profile",
+						Aliases: []string{"p"},
+						Usage:   "profile to log in to",
+					},
+					&cli.BoolFlag{
+						Name:  "no-browser",
+						Usage: "print the login url instead of opening a browser, e.g. over ssh",
+					},
+					&cli.StringFlag{
+						Name:    "callback-address",
+						Usage:   "address the login callback server binds to e.g. 127.0.0.1:7070, a free port is picked by default",
+						EnvVars: []string{"OTTER_CALLBACK_ADDRESS"},
+					},
+					&cli.StringSliceFlag{
+						Name:    "scope",
+						Aliases: []string{"s"},
+						Usage:   "oauth scope to log in with, repeat for several e.g. --scope read --scope identity (default: read-protected write-protected)",
+					},
 				},
-				Action: func(c *cli.Context) error {
-					spinner, err := internal.LoadingSpinner()
-					if err != nil {
-						spinner.Prefix("something went wrong...")
-						spinner.StopFail()
+				Subcommands: []*cli.Command{
+					{
+						Name:    "status",
+						Aliases: []string{"whoami"},
+						Usage:   "show the active profile, account and credentials",
+						Flags:   outputFlags(),
+						Action:  authStatusAction,
+					},
+					{
+						Name:  "tokens",
+						Usage: "manage the oauth authorizations of your account",
+						Flags: outputFlags(),
+						Action: func(c *cli.Context) error {
+							var authorizations []Authorization
+							err := withSpinner(func(token string) (err error) {
+								authorizations, err = ListAuthorizations(token)
+								return err
+							})
+							if err != nil {
+								return err
+							}
 
-						return cli.Exit(err.Error(), 1)
+							return render(c, authorizationsOutput(authorizations))
+						},
+						Subcommands: []*cli.Command{
+							{
+								Name:   "create",
+								Usage:  "create a long-lived token, e.g. for ci",
+								Before: requireWrite,
+								Flags: append([]cli.Flag{
+									&cli.StringSliceFlag{
+										Name:    "scope",
+										Aliases: []string{"s"},
+										Usage:   "scope granted to the token, repeat for several e.g. --scope read --scope write",
+										Value:   cli.NewStringSlice("global"),
+									},
+									&cli.StringFlag{
+										Name:    "description",
+										Aliases: []string{"d"},
+										Usage:   "what the token is used for",
+									},
+								}, outputFlags()...),
+								Action: func(c *cli.Context) error {
+									// the token is shown once, don't create it to then fail on the format
+									if err := internal.CheckOutputFormat(outputFormat(c)); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									var a *Authorization
+									err := withSpinner(func(token string) (err error) {
+										a, err = CreateAuthorization(token, c.StringSlice("scope"), c.String("description"))
+										return err
+									})
+									if err != nil {
+										return err
+									}
+
+									if !internal.Quiet() {
+										fmt.Fprintln(os.Stderr, "The token is shown once on creation - keep it somewhere safe.")
+									}
+									return render(c, authorizationOutput(a))
+								},
+							},
+							{
+								Name:      "info",
+								Usage:     "show a single authorization",
+								ArgsUsage: "<id>",
+								Flags:     outputFlags(),
+								Action: func(c *cli.Context) error {
+									id, err := authorizationArg(c)
+									if err != nil {
+										return err
+									}
+
+									var a *Authorization
+									err = withSpinner(func(token string) (err error) {
+										a, err = GetAuthorization(token, id)
+										return err
+									})
+									if err != nil {
+										return err
+									}
+
+									return render(c, authorizationOutput(a))
+								},
+							},
+							{
+								Name:      "regenerate",
+								Usage:     "replace the tokens of an authorization",
+								Before:    requireWrite,
+								ArgsUsage: "<id>",
+								Flags:     outputFlags(),
+								Action: func(c *cli.Context) error {
+									id, err := authorizationArg(c)
+									if err != nil {
+										return err
+									}
+
+									if err := internal.CheckOutputFormat(outputFormat(c)); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									var a *Authorization
+									err = withSpinner(func(token string) (err error) {
+										a, err = RegenerateAuthorization(token, id)
+										return err
+									})
+									if err != nil {
+										return err
+									}
+
+									return render(c, authorizationOutput(a))
+								},
+							},
+							{
+								Name:      "revoke",
+								Usage:     "revoke an authorization, its tokens stop working",
+								Before:    requireWrite,
+								ArgsUsage: "<id>",
+								Action: func(c *cli.Context) error {
+									id, err := authorizationArg(c)
+									if err != nil {
+										return err
+									}
+
+									var a *Authorization
+									err = withSpinner(func(token string) (err error) {
+										a, err = RevokeAuthorizationByID(token, id)
+										return err
+									})
+									if err != nil {
+										return err
+									}
+
+									fmt.Printf("Revoked authorization %s\n", a.ID)
+									return nil
+								},
+							},
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "list your profiles",
+						Flags: outputFlags(),
+						Action: func(c *cli.Context) error {
+							profiles, err := internal.ListProfiles()
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							if len(profiles) == 0 {
+								fmt.Println("No profiles yet - log in with otter auth [--profile name]")
+								return nil
+							}
+
+							out := &internal.Output{
+								Fields: []internal.Field{
+									{Name: "active", Header: "Active", Format: mark},
+									{Name: "profile", Header: "Profile"},
+									{Name: "app", Header: "Default App"},
+								},
+							}
+
+							for _, name := range profiles {
+								var app string
+								if p, ok := settings.Profiles[name]; ok && p != nil {
+									app = p.App
+								}
+
+								out.Add(name == internal.ActiveProfile(), name, app)
+							}
+
+							return render(c, out)
+						},
+					},
+					{
+						Name:      "use",
+						Usage:     "switch to a profile",
+						ArgsUsage: "<profile>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "app",
+								Aliases: []string{"a"},
+								Usage:   "default app for the profile",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							name := c.Args().First()
+							if name == "" {
+								return cli.Exit("missing profile name - otter auth use <profile>", 1)
+							}
+
+							if err := internal.SetProfile(name); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							settings.Profile = name
+
+							if c.IsSet("app") {
+								if settings.Profiles == nil {
+									settings.Profiles = map[string]*internal.ProfileSettings{}
+								}
+
+								defaults := settings.ProfileDefaults()
+								defaults.App = c.String("app")
+								settings.Profiles[name] = defaults
+							}
+
+							if err := internal.SaveSettings(settings); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							fmt.Printf("Now using profile %s\n", name)
+							return nil
+						},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.IsSet("profile") {
+						if err := internal.SetProfile(c.String("profile")); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 					}
 
 					if c.IsSet("revoke") {
+						spinner := internal.LoadingSpinner()
+						defer spinner.StopFail()
+
 						spinner.Start()
 						if err := internal.RevokeAuthorization(); err != nil {
+							spinner.Prefix("something went wrong...")
 							return cli.Exit(err.Error(), 1)
 						}
 
-						spinner.Prefix("Done")
+						spinner.Prefix("Done.")
+						spinner.Stop()
 						return nil
 					}
 
-					fmt.Println("Opening browser - authorize otter client with your heroku account.")
-					spinner.Prefix("Waiting for authorization...")
-					spinner.Start()
-					if err := AuthorizeClient(); err != nil {
+					scopes, err := internal.ParseScopes(c.StringSlice("scope"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					client := internal.LocalOAuthClient()
+
+					addr := internal.CallbackAddress(client != nil)
+					if c.IsSet("callback-address") {
+						addr = c.String("callback-address")
+					}
+
+					if c.Bool("no-browser") {
+						fmt.Printf("Log in to otter with your heroku account (profile %s).\n", internal.ActiveProfile())
+
+						if client != nil {
+							if err := AuthorizeLocalHeadless(client, addr, scopes, os.Stdout, os.Stdin); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							fmt.Println("You are now logged in ✓")
+							return nil
+						}
+
+						if err := AuthorizeHeadless(scopes, os.Stdout); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						fmt.Println("You are now logged in ✓")
+						return nil
+					}
+
+					// no spinner while the login waits on the browser, the flow prints to stdout
+					fmt.Printf("Opening browser - authorize otter client with your heroku account (profile %s).\n", internal.ActiveProfile())
+					fmt.Println("Waiting for authorization...")
+
+					authorize := func() error { return AuthorizeClient(addr, scopes) }
+					if client != nil {
+						authorize = func() error { return AuthorizeLocal(client, addr, scopes) }
+					}
+
+					if err := authorize(); err != nil {
 						return cli.Exit(err.Error(), 1)
 					}
 
+					fmt.Println("You are now logged in ✓")
 					return nil
 				},
 			},
@@ -58,13 +437,8 @@ func Execute() *cli.App {
 				Name:    "config",
 				Aliases: []string{"c"},
 				Usage:   "Control your deployment's config vars",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:     "app",
-						Aliases:  []string{"a"},
-						Usage:    "your app name/id",
-						Required: true,
-					},
+				Flags: append([]cli.Flag{
+					appFlag(),
 					&cli.BoolFlag{
 						Name:    "list",
 						Aliases: []string{"l"},
@@ -85,13 +459,39 @@ func Execute() *cli.App {
 						Aliases: []string{"r"},
 						Usage:   "remove variable(s)",
 					},
-				},
+					&cli.StringFlag{
+						Name:  "filter",
+						Usage: "list only keys matching a glob e.g. 'DATABASE_*', or a regex between slashes e.g. '/^(DB|REDIS)_/'",
+					},
+					&cli.StringFlag{
+						Name:  "grep",
+						Usage: "list only values matching a regex, masked values are matched as shown",
+					},
+					&cli.BoolFlag{
+						Name:  "mask",
+						Usage: "hide secret looking values and url passwords",
+					},
+					&cli.BoolFlag{
+						Name:  "show-source",
+						Usage: "show the add-on attachment setting each variable",
+					},
+				}, outputFlags()...),
 				Action: func(c *cli.Context) error {
-					app := c.String("app")
-					spinner, err := internal.LoadingSpinner()
+					app, err := appName(c)
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					if variable := c.String("set"); c.IsSet("set") && !strings.Contains(variable, ":") {
+						return cli.Exit(fmt.Sprintf("invalid variable %s - use key:value", variable), 1)
+					}
+
+					spinner := internal.LoadingSpinner()
 					spinner.Start()
+					// stopping a stopped spinner does nothing, this covers every error path
+					defer spinner.StopFail()
 
-					tokens, err := internal.GetAuthTokens()
+					tokens, err := authTokens()
 
 					if err != nil {
 						spinner.Prefix("something went wrong...")
@@ -99,32 +499,40 @@ func Execute() *cli.App {
 						return err
 					}
 
+					if c.IsSet("file") || c.IsSet("set") || c.IsSet("remove") {
+						if err := tokens.RequireWrite(); err != nil {
+							spinner.StopFail()
+							return cli.Exit(err.Error(), 1)
+						}
+					}
+
 					if c.Bool("list") {
 						result, err := GetVariables(app, tokens.AccessToken)
 						if err != nil {
 							return err
 						}
 
-						spinner.Prefix("Done.")
+						filter := VariablesFilter{Keys: c.String("filter"), Values: c.String("grep"), Mask: c.Bool("mask")}
+						if c.Bool("show-source") {
+							if filter.Attachments, err = ListAddonAttachments(app, tokens.AccessToken); err != nil {
+								return err
+							}
 
-						spinner.Stop()
+							if filter.Attachments == nil {
+								filter.Attachments = []AddonAttachment{}
+							}
+						}
 
-						var out []interface{}
+						spinner.Prefix("Done.")
 
-						for k, v := range result {
-							out = append(out, map[string]interface{}{
-								"key":   k,
-								"value": v,
-							})
-						}
+						spinner.Stop()
 
-						table, err := internal.GenerateDataTable(out)
+						out, err := variablesOutput(result, filter)
 						if err != nil {
-							return err
+							return cli.Exit(err.Error(), 1)
 						}
 
-						fmt.Println(table.String())
-						return nil
+						return render(c, out)
 					}
 
 					if file := c.String("file"); c.IsSet("file") {
@@ -150,11 +558,9 @@ func Execute() *cli.App {
 					}
 
 					if variable := c.String("set"); c.IsSet("set") {
-						key := strings.Split(variable, ":")[0]
-						value := strings.Split(variable, ":")[1]
 						kv := ConfigVar{
-							key,
-							value,
+							variable[:strings.Index(variable, ":")],
+							variable[strings.Index(variable, ":")+1:],
 						}
 
 						if err := UpsertVariable(app, tokens.AccessToken, kv); err != nil {
@@ -179,8 +585,472 @@ func Execute() *cli.App {
 					return nil
 				},
 			},
+			{
+				Name:  "apps",
+				Usage: "list all apps available to your account",
+				Flags: append(rangeFlags("name", "asc"), outputFlags()...),
+				Action: func(c *cli.Context) error {
+					spinner := internal.LoadingSpinner()
+					spinner.Start()
+
+					tokens, err := authTokens()
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					apps, err := ListApps(tokens.AccessToken, listRange("name"))
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					spinner.Prefix("Done.")
+					spinner.Stop()
+
+					return render(c, appsOutput(apps))
+				},
+			},
+			{
+				Name:  "releases",
+				Usage: "list all releases of an app",
+				Flags: append(append([]cli.Flag{appFlag()}, rangeFlags("version", "desc")...), outputFlags()...),
+				Action: func(c *cli.Context) error {
+					app, err := appName(c)
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					spinner := internal.LoadingSpinner()
+					spinner.Start()
+
+					tokens, err := authTokens()
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					releases, err := ListReleases(app, tokens.AccessToken, listRange("version"))
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					spinner.Prefix("Done.")
+					spinner.Stop()
+
+					return render(c, releasesOutput(releases))
+				},
+			},
+			{
+				Name:  "builds",
+				Usage: "list all builds of an app",
+				Flags: append(append([]cli.Flag{appFlag()}, rangeFlags("created_at", "desc")...), outputFlags()...),
+				Action: func(c *cli.Context) error {
+					app, err := appName(c)
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					spinner := internal.LoadingSpinner()
+					spinner.Start()
+
+					tokens, err := authTokens()
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					builds, err := ListBuilds(app, tokens.AccessToken, listRange("created_at"))
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					spinner.Prefix("Done.")
+					spinner.Stop()
+
+					return render(c, buildsOutput(builds))
+				},
+			},
+			{
+				Name:  "collaborators",
+				Usage: "list all collaborators of an app",
+				Flags: append(append([]cli.Flag{appFlag()}, rangeFlags("email", "asc")...), outputFlags()...),
+				Action: func(c *cli.Context) error {
+					app, err := appName(c)
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					spinner := internal.LoadingSpinner()
+					spinner.Start()
+
+					tokens, err := authTokens()
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					collaborators, err := ListCollaborators(app, tokens.AccessToken, listRange("email"))
+					if err != nil {
+						spinner.Prefix("something went wrong...")
+						spinner.StopFail()
+						return err
+					}
+
+					spinner.Prefix("Done.")
+					spinner.Stop()
+
+					return render(c, collaboratorsOutput(collaborators))
+				},
+			},
+			{
+				Name:   "whoami",
+				Usage:  "show the active profile, account and credentials",
+				Flags:  outputFlags(),
+				Action: authStatusAction,
+			},
+			{
+				Name:  "account",
+				Usage: "inspect your heroku account",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "rate-limit",
+						Usage: "show your remaining api request budget",
+						Flags: outputFlags(),
+						Action: func(c *cli.Context) error {
+							spinner := internal.LoadingSpinner()
+							spinner.Start()
+
+							tokens, err := authTokens()
+							if err != nil {
+								spinner.Prefix("something went wrong...")
+								spinner.StopFail()
+								return err
+							}
+
+							remaining, err := GetRateLimit(tokens.AccessToken)
+							if err != nil {
+								spinner.Prefix("something went wrong...")
+								spinner.StopFail()
+								return err
+							}
+
+							spinner.Prefix("Done.")
+							spinner.Stop()
+
+							if format := outputFormat(c); format != internal.OUTPUT_TABLE {
+								out := &internal.Output{Fields: []internal.Field{{Name: "remaining", Header: "Remaining"}}, Single: true}
+								out.Add(remaining)
+								return render(c, out)
+							}
+
+							fmt.Printf("%d requests remaining (replenished at ~75 per minute, up to 4500)\n", remaining)
+							return nil
+						},
+					},
+				},
+			},
 		},
 	}
 
 	return app
 }
+
+// configureTransport - apply proxy, ca bundle and timeout settings,
+// flags and env take precedence over the settings file
+func configureTransport(c *cli.Context) error {
+	var err error
+
+	caFile := settings.CAFile
+	if c.IsSet("ca-file") {
+		caFile = c.String("ca-file")
+	}
+
+	var timeout time.Duration
+	if settings.Timeout != "" {
+		if timeout, err = time.ParseDuration(settings.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout in settings: %s", settings.Timeout)
+		}
+	}
+	if c.IsSet("timeout") {
+		timeout = c.Duration("timeout")
+	}
+
+	return internal.ConfigureTransport(caFile, timeout)
+}
+
+// authTokens - load credentials for the active profile, noting on stderr when an api key is used
+func authTokens() (*internal.TokenPair, error) {
+	tokens, err := internal.GetAuthTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	if tokens.Source != internal.SOURCE_LOGIN && !internal.Quiet() {
+		fmt.Fprintf(os.Stderr, "Using credentials from %s\n", tokens.Source)
+	}
+
+	return tokens, nil
+}
+
+// requireWrite - refuse commands making changes when the active credentials are read-only
+func requireWrite(c *cli.Context) error {
+	tokens, err := internal.GetAuthTokens()
+	if err != nil {
+		// commands report missing credentials themselves
+		return nil
+	}
+
+	if err := tokens.RequireWrite(); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// authStatusAction - print the active credentials and whether the api accepts them
+func authStatusAction(c *cli.Context) error {
+	status, err := GetAuthStatus()
+	if err != nil {
+		if errors.Is(err, internal.ErrNoTokens) {
+			return cli.Exit(fmt.Sprintf("Not logged in (profile %s) - run otter auth", internal.ActiveProfile()), 1)
+		}
+		return cli.Exit(err.Error(), 1)
+	}
+
+	if outputFormat(c) != internal.OUTPUT_TABLE {
+		if err := render(c, authStatusOutput(status)); err != nil {
+			return err
+		}
+
+		if status.AccountErr != nil {
+			return cli.Exit("", 1)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Profile:\t%s\n", status.Profile)
+
+	if status.Account != nil {
+		fmt.Fprintf(w, "Account:\t%s (%s)\n", status.Account.Email, status.Account.Name)
+	} else {
+		fmt.Fprintf(w, "Account:\tunknown\n")
+	}
+
+	if status.Store != "" {
+		fmt.Fprintf(w, "Credentials:\t%s, %s token store\n", status.Source, status.Store)
+	} else {
+		fmt.Fprintf(w, "Credentials:\t%s\n", status.Source)
+	}
+
+	switch {
+	case !status.ExpiresAt.IsZero():
+		fmt.Fprintf(w, "Token expiry:\t%s (in %s)\n", status.ExpiresAt.Local().Format("2006-01-02 15:04 MST"), time.Until(status.ExpiresAt).Round(time.Minute))
+	case status.Source == internal.SOURCE_LOGIN:
+		fmt.Fprintf(w, "Token expiry:\tunknown, refreshed when rejected\n")
+	default:
+		fmt.Fprintf(w, "Token expiry:\tnever (api key)\n")
+	}
+
+	if len(status.Scopes) > 0 {
+		fmt.Fprintf(w, "Scopes:\t%s\n", strings.Join(status.Scopes, " "))
+	} else {
+		fmt.Fprintf(w, "Scopes:\tunknown\n")
+	}
+
+	if status.AccountErr != nil {
+		fmt.Fprintf(w, "API:\tfailed - %s\n", status.AccountErr.Error())
+		w.Flush()
+		return cli.Exit("", 1)
+	}
+
+	fmt.Fprintf(w, "API:\tok (GET /account in %s)\n", status.Latency.Round(time.Millisecond))
+	return w.Flush()
+}
+
+// withSpinner - run an api call with the active credentials behind a loading spinner,
+// stopped with a failure mark when the call fails. Output is written once it returns.
+// [fn] - call made with the access token
+func withSpinner(fn func(token string) error) error {
+	spinner := internal.LoadingSpinner()
+	spinner.Start()
+
+	tokens, err := authTokens()
+	if err == nil {
+		err = fn(tokens.AccessToken)
+	}
+
+	if err != nil {
+		spinner.Prefix("something went wrong...")
+		spinner.StopFail()
+		return cli.Exit(err.Error(), 1)
+	}
+
+	spinner.Prefix("Done.")
+	spinner.Stop()
+	return nil
+}
+
+// authorizationArg - authorization id passed as the first argument
+func authorizationArg(c *cli.Context) (string, error) {
+	id := c.Args().First()
+	if id == "" {
+		return "", cli.Exit(fmt.Sprintf("missing authorization id - otter auth tokens %s <id>", c.Command.Name), 1)
+	}
+
+	return id, nil
+}
+
+// outputFlags - flags of read commands, the global --output and --style apply when they aren't set
+func outputFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "output format - table, json, yaml, csv or tsv",
+		},
+		&cli.StringFlag{
+			Name:  "columns",
+			Usage: "comma separated fields to show, in order e.g. name,owner",
+		},
+		&cli.StringFlag{
+			Name:  "style",
+			Usage: "table style - markdown, compact or borderless",
+		},
+	}
+}
+
+// lineageString - a flag of the command, or of the closest parent command setting it
+// [name] - flag name
+// [value] - default when no command sets it
+func lineageString(c *cli.Context, name, value string) string {
+	for _, ctx := range c.Lineage() {
+		if ctx.IsSet(name) {
+			return ctx.String(name)
+		}
+	}
+
+	return value
+}
+
+// outputFormat - --output of the command
+func outputFormat(c *cli.Context) string {
+	return lineageString(c, "output", internal.OUTPUT_TABLE)
+}
+
+// render - write a read command's output to stdout in the --output format,
+// with the --columns, --sort and --order of the command applied
+// [out] - records shown by the command
+func render(c *cli.Context, out *internal.Output) error {
+	format := outputFormat(c)
+	if err := internal.CheckOutputFormat(format); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	// only list commands have --sort
+	if field := c.String("sort"); field != "" {
+		order := c.String("order")
+		if order != "asc" && order != "desc" {
+			return cli.Exit(fmt.Sprintf("unknown order %s - use asc or desc", order), 1)
+		}
+
+		if err := out.Sort(field, order == "desc"); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+	}
+
+	if columns := c.String("columns"); columns != "" {
+		var names []string
+		for _, name := range strings.Split(columns, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+
+		if err := out.Select(names); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+	}
+
+	out.Style = lineageString(c, "style", internal.STYLE_MARKDOWN)
+	if err := internal.CheckTableStyle(out.Style); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	// pipes and files get the full values
+	if stdout == os.Stdout {
+		out.Width = internal.TerminalWidth(os.Stdout)
+	}
+
+	return out.Render(stdout, format)
+}
+
+// mark - a true value as the * of table columns e.g. the active profile
+func mark(v interface{}) string {
+	if b, ok := v.(bool); ok && b {
+		return "*"
+	}
+
+	return ""
+}
+
+// appFlag - app name/id flag shared by app scoped commands
+func appFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "app",
+		Aliases: []string{"a"},
+		Usage:   "your app name/id, defaults to the active profile's app",
+	}
+}
+
+// appName - app from --app or the active profile's default
+func appName(c *cli.Context) (string, error) {
+	if app := c.String("app"); app != "" {
+		return app, nil
+	}
+
+	if app := settings.ProfileDefaults().App; app != "" {
+		return app, nil
+	}
+
+	return "", errors.New("missing app - pass --app or set a default with otter auth use --app <app> <profile>")
+}
+
+// rangeFlags - sort and order flags for list commands
+// [field] - default sort field
+// [order] - default sort order
+func rangeFlags(field, order string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "sort",
+			Usage: "field to sort results by, any of the output's fields",
+			Value: field,
+		},
+		&cli.StringFlag{
+			Name:  "order",
+			Usage: "sort order - asc or desc",
+			Value: order,
+		},
+	}
+}
+
+// listRange - fetch every result of a list endpoint, --sort orders them once fetched
+// so it isn't limited to the fields heroku ranges over
+// [field] - a field the endpoint ranges over
+func listRange(field string) internal.ListRange {
+	return internal.ListRange{
+		Field: field,
+		Max:   1000,
+	}
+}
@@ -1,19 +1,19 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/Mayowa-Ojo/otter/internal"
-	// "strings"
 )
 
-const baseURI = "https://api.heroku.com"
-
 // ConfigVar - environment variable key-value pair
 type ConfigVar struct {
 	key   string
@@ -23,21 +23,15 @@ type ConfigVar struct {
 // GetVariables - fetch all config vars for given app
 // [app] - app name or id
 func GetVariables(app, token string) (map[string]interface{}, error) {
-	uri := fmt.Sprintf("%s/apps/%s/config-vars", baseURI, app)
-	client := &http.Client{}
+	path := fmt.Sprintf("/apps/%s/config-vars", app)
+	client := internal.NewAPIClient(token)
 
-	req, err := http.NewRequest("GET", uri, nil)
+	resp, err := client.Do("GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		if resp.StatusCode == 401 {
@@ -63,28 +57,17 @@ func GetVariables(app, token string) (map[string]interface{}, error) {
 // UpsertVariable - add or update an existing variable
 // [app] - app name or id
 func UpsertVariable(app, token string, variable ConfigVar) error {
-	uri := fmt.Sprintf("%s/apps/%s/config-vars", baseURI, app)
-	client := &http.Client{}
+	path := fmt.Sprintf("/apps/%s/config-vars", app)
+	client := internal.NewAPIClient(token)
 
-	body, err := json.Marshal(map[string]string{
+	resp, err := client.Do("PATCH", path, map[string]string{
 		variable.key: variable.value,
 	})
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("PATCH", uri, bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		if resp.StatusCode == 401 {
@@ -101,8 +84,8 @@ func UpsertVariable(app, token string, variable ConfigVar) error {
 // [source] - can be a json, yaml or .env file
 // [app] - app name or id
 func UpsertVariables(app, token, path, source string) error {
-	uri := fmt.Sprintf("%s/apps/%s/config-vars", baseURI, app)
-	client := &http.Client{}
+	resource := fmt.Sprintf("/apps/%s/config-vars", app)
+	client := internal.NewAPIClient(token)
 	var content map[string]string
 
 	switch source {
@@ -129,23 +112,12 @@ func UpsertVariables(app, token, path, source string) error {
 		content = c
 	}
 
-	body, err := json.Marshal(content)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("PATCH", uri, bytes.NewBuffer(body))
+	resp, err := client.Do("PATCH", resource, content)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		if resp.StatusCode == 401 {
@@ -173,28 +145,17 @@ func UpsertVariables(app, token, path, source string) error {
 // [token] - access token
 // [key] - variable to be removed
 func RemoveVariable(app, token, key string) error {
-	uri := fmt.Sprintf("%s/apps/%s/config-vars", baseURI, app)
-	client := &http.Client{}
+	path := fmt.Sprintf("/apps/%s/config-vars", app)
+	client := internal.NewAPIClient(token)
 
-	body, err := json.Marshal(map[string]interface{}{
+	resp, err := client.Do("PATCH", path, map[string]interface{}{
 		key: nil,
 	})
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("PATCH", uri, bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		if resp.StatusCode == 401 {
@@ -205,3 +166,170 @@ func RemoveVariable(app, token, key string) error {
 
 	return nil
 }
+
+// AddonAttachment - add-on attached to an app, the config vars it sets are prefixed by its name
+type AddonAttachment struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Addon struct {
+		Name string `json:"name"`
+	} `json:"addon"`
+}
+
+// ListAddonAttachments - fetch every add-on attachment of an app
+// [app] - app name or id
+// [token] - access token
+func ListAddonAttachments(app, token string) ([]AddonAttachment, error) {
+	var attachments []AddonAttachment
+	path := fmt.Sprintf("/apps/%s/addon-attachments", app)
+
+	if err := internal.NewAPIClient(token).List(path, internal.ListRange{}, &attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// VariablesFilter - which config vars otter config --list shows and how
+type VariablesFilter struct {
+	// Keys - glob e.g. DATABASE_*, or a regex between slashes e.g. /^(DB|REDIS)_/
+	Keys string
+	// Values - regex matched against values as shown, masked values don't match what they hide
+	Values string
+	// Mask - hide secrets, see maskValue
+	Mask bool
+	// Attachments - add-on attachments whose vars get a source, nil leaves out the source field
+	Attachments []AddonAttachment
+}
+
+// maskedValue - what a masked secret reads as
+const maskedValue = "xxxxx"
+
+// secretWords - words of config var keys holding secrets e.g. STRIPE_SECRET_KEY
+var secretWords = map[string]bool{
+	"KEY": true, "SECRET": true, "TOKEN": true, "PASSWORD": true, "PASS": true,
+	"PASSWD": true, "PRIVATE": true, "CREDENTIALS": true, "SALT": true,
+}
+
+// maskValue - hide the value of a secret looking key, and the password of urls e.g. DATABASE_URL
+// [key] - config var key
+// [value] - config var value
+func maskValue(key, value string) string {
+	for _, word := range strings.FieldsFunc(strings.ToUpper(key), func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if secretWords[word] {
+			return maskedValue
+		}
+	}
+
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+
+	return value
+}
+
+// keyMatcher - match keys against a glob, or a regex between slashes
+// [pattern] - --filter value
+func keyMatcher(pattern string) (func(key string) bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter regex %s - %v", pattern, err)
+		}
+
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid --filter glob %s", pattern)
+	}
+
+	return func(key string) bool {
+		ok, _ := path.Match(pattern, key)
+		return ok
+	}, nil
+}
+
+// variableSource - add-on attachment setting a config var, the longest attachment name prefixing the key
+func variableSource(key string, attachments []AddonAttachment) interface{} {
+	var source *AddonAttachment
+	for i, a := range attachments {
+		if key != a.Name && !strings.HasPrefix(key, a.Name+"_") {
+			continue
+		}
+
+		if source == nil || len(a.Name) > len(source.Name) {
+			source = &attachments[i]
+		}
+	}
+
+	if source == nil {
+		return nil
+	}
+
+	return source.Addon.Name
+}
+
+// variablesOutput - config vars as shown by otter config --list, sorted by key
+// [vars] - config vars of the app
+// [filter] - which vars are shown and how
+func variablesOutput(vars map[string]interface{}, filter VariablesFilter) (*internal.Output, error) {
+	out := &internal.Output{Fields: []internal.Field{
+		{Name: "key", Header: "Key"},
+		{Name: "value", Header: "Value", Wrap: true},
+	}, Empty: "No config vars set"}
+
+	if filter.Attachments != nil {
+		out.Fields = append(out.Fields, internal.Field{Name: "source", Header: "Source"})
+	}
+
+	matchKey := func(string) bool { return true }
+	if filter.Keys != "" {
+		var err error
+		if matchKey, err = keyMatcher(filter.Keys); err != nil {
+			return nil, err
+		}
+	}
+
+	var grep *regexp.Regexp
+	if filter.Values != "" {
+		var err error
+		if grep, err = regexp.Compile(filter.Values); err != nil {
+			return nil, fmt.Errorf("invalid --grep regex %s - %v", filter.Values, err)
+		}
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !matchKey(k) {
+			continue
+		}
+
+		value := fmt.Sprint(vars[k])
+		if vars[k] == nil {
+			value = ""
+		}
+		if filter.Mask {
+			value = maskValue(k, value)
+		}
+
+		if grep != nil && !grep.MatchString(value) {
+			continue
+		}
+
+		if filter.Attachments != nil {
+			out.Add(k, value, variableSource(k, filter.Attachments))
+		} else {
+			out.Add(k, value)
+		}
+	}
+
+	return out, nil
+}
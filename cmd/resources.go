@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Mayowa-Ojo/otter/internal"
+)
+
+// App - heroku app summary
+type App struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Region struct {
+		Name string `json:"name"`
+	} `json:"region"`
+	Stack struct {
+		Name string `json:"name"`
+	} `json:"stack"`
+	Owner struct {
+		Email string `json:"email"`
+	} `json:"owner"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Release - heroku app release
+type Release struct {
+	ID          string `json:"id"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Current     bool   `json:"current"`
+	User        struct {
+		Email string `json:"email"`
+	} `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Build - heroku app build
+type Build struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Stack  string `json:"stack"`
+	User   struct {
+		Email string `json:"email"`
+	} `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Collaborator - user with access to a heroku app
+type Collaborator struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+	User struct {
+		Email string `json:"email"`
+	} `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ListApps - fetch every app available to the account
+// [token] - access token
+// [rng] - sort and order control
+func ListApps(token string, rng internal.ListRange) ([]App, error) {
+	var apps []App
+
+	if err := internal.NewAPIClient(token).List("/apps", rng, &apps); err != nil {
+		return nil, err
+	}
+
+	return apps, nil
+}
+
+// ListReleases - fetch every release of an app
+// [app] - app name or id
+// [token] - access token
+// [rng] - sort and order control
+func ListReleases(app, token string, rng internal.ListRange) ([]Release, error) {
+	var releases []Release
+	path := fmt.Sprintf("/apps/%s/releases", app)
+
+	if err := internal.NewAPIClient(token).List(path, rng, &releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// ListBuilds - fetch every build of an app
+// [app] - app name or id
+// [token] - access token
+// [rng] - sort and order control
+func ListBuilds(app, token string, rng internal.ListRange) ([]Build, error) {
+	var builds []Build
+	path := fmt.Sprintf("/apps/%s/builds", app)
+
+	if err := internal.NewAPIClient(token).List(path, rng, &builds); err != nil {
+		return nil, err
+	}
+
+	return builds, nil
+}
+
+// ListCollaborators - fetch every collaborator of an app
+// [app] - app name or id
+// [token] - access token
+// [rng] - sort and order control
+func ListCollaborators(app, token string, rng internal.ListRange) ([]Collaborator, error) {
+	var collaborators []Collaborator
+	path := fmt.Sprintf("/apps/%s/collaborators", app)
+
+	if err := internal.NewAPIClient(token).List(path, rng, &collaborators); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// appsOutput - apps as shown by otter apps
+func appsOutput(apps []App) *internal.Output {
+	out := &internal.Output{Fields: []internal.Field{
+		{Name: "name", Header: "Name"},
+		{Name: "region", Header: "Region"},
+		{Name: "stack", Header: "Stack"},
+		{Name: "owner", Header: "Owner"},
+		{Name: "updated_at", Header: "Updated"},
+	}, Empty: "No apps yet"}
+
+	for _, a := range apps {
+		out.Add(a.Name, a.Region.Name, a.Stack.Name, a.Owner.Email, a.UpdatedAt)
+	}
+
+	return out
+}
+
+// releasesOutput - releases as shown by otter releases
+func releasesOutput(releases []Release) *internal.Output {
+	out := &internal.Output{Fields: []internal.Field{
+		{Name: "version", Header: "Version", Format: func(v interface{}) string { return fmt.Sprintf("v%d", v) }},
+		{Name: "description", Header: "Description", Wrap: true},
+		{Name: "status", Header: "Status"},
+		{Name: "user", Header: "User"},
+		{Name: "created_at", Header: "Created"},
+	}, Empty: "No releases yet"}
+
+	for _, r := range releases {
+		out.Add(r.Version, r.Description, r.Status, r.User.Email, r.CreatedAt)
+	}
+
+	return out
+}
+
+// buildsOutput - builds as shown by otter builds
+func buildsOutput(builds []Build) *internal.Output {
+	out := &internal.Output{Fields: []internal.Field{
+		{Name: "id", Header: "ID"},
+		{Name: "status", Header: "Status"},
+		{Name: "stack", Header: "Stack"},
+		{Name: "user", Header: "User"},
+		{Name: "created_at", Header: "Created"},
+	}, Empty: "No builds yet"}
+
+	for _, b := range builds {
+		out.Add(b.ID, b.Status, b.Stack, b.User.Email, b.CreatedAt)
+	}
+
+	return out
+}
+
+// collaboratorsOutput - collaborators as shown by otter collaborators
+func collaboratorsOutput(collaborators []Collaborator) *internal.Output {
+	out := &internal.Output{Fields: []internal.Field{
+		{Name: "email", Header: "Email"},
+		{Name: "role", Header: "Role"},
+		{Name: "created_at", Header: "Added"},
+	}, Empty: "No collaborators"}
+
+	for _, cl := range collaborators {
+		out.Add(cl.User.Email, cl.Role, cl.CreatedAt)
+	}
+
+	return out
+}
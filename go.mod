@@ -1,17 +1,18 @@
 module github.com/Mayowa-Ojo/otter
 
-go 1.13
+go 1.16
 
 require (
-	github.com/alexeyco/simpletable v0.0.0-20200730140406-5bb24159ccfb
 	github.com/goccy/go-yaml v1.8.9
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/google/go-cmp v0.5.4 // indirect
 	github.com/gorilla/mux v1.8.0
 	github.com/joho/godotenv v1.3.0
-	github.com/mattn/go-runewidth v0.0.10 // indirect
+	github.com/mattn/go-runewidth v0.0.10
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/theckman/yacspin v0.8.0
 	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/sys v0.0.0-20200223170610-d5e6a3e2c0ae
 )
 
 // +heroku install ./web/...
@@ -0,0 +1,349 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// API_URL - heroku platform api base url
+const API_URL string = "https://api.heroku.com"
+
+const (
+	// maxRetries - how many times a throttled or unavailable request is retried
+	maxRetries = 5
+	// backoffBase - initial backoff delay, doubled on every attempt
+	backoffBase = 1 * time.Second
+	// backoffCap - upper bound for a single backoff delay
+	backoffCap = 30 * time.Second
+	// rateLimitLow - remaining budget below which requests are paced
+	rateLimitLow = 100
+	// replenishInterval - heroku replenishes roughly 75 requests per minute
+	replenishInterval = time.Minute / 75
+	// maxPageSize - largest page heroku serves for list endpoints
+	maxPageSize = 1000
+)
+
+// sleep - swapped out in tests to avoid real delays
+var sleep = time.Sleep
+
+// RateLimitState - last request budget reported by the heroku api
+type RateLimitState struct {
+	mu        sync.Mutex
+	remaining int
+	known     bool
+	updatedAt time.Time
+}
+
+// rateLimit - shared across all clients, the budget belongs to the account not the request
+var rateLimit = &RateLimitState{}
+
+// Remaining - last known remaining request budget
+// [ok] - false when no api response has reported a budget yet
+func (s *RateLimitState) Remaining() (remaining int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remaining, s.known
+}
+
+func (s *RateLimitState) update(h http.Header) {
+	v := h.Get("RateLimit-Remaining")
+	if v == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.remaining = n
+	s.known = true
+	s.updatedAt = time.Now()
+	s.mu.Unlock()
+}
+
+// delay - how long to wait before the next request so the budget can replenish
+func (s *RateLimitState) delay() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.known || s.remaining >= rateLimitLow {
+		return 0
+	}
+
+	remaining := s.remaining
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// tokens replenished since the last response count towards the budget
+	remaining += int(time.Since(s.updatedAt) / replenishInterval)
+	if remaining >= rateLimitLow {
+		return 0
+	}
+
+	// slow down gradually, reaching the replenish rate as the budget hits zero
+	return replenishInterval * time.Duration(rateLimitLow-remaining) / rateLimitLow
+}
+
+// CurrentRateLimit - request budget tracker shared by all api clients
+func CurrentRateLimit() *RateLimitState {
+	return rateLimit
+}
+
+// APIClient - heroku platform api client
+type APIClient struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewAPIClient - create an api client authorized with the given token
+// [token] - access token
+func NewAPIClient(token string) *APIClient {
+	return &APIClient{
+		BaseURL:    APIURL(),
+		Token:      token,
+		HTTPClient: HTTPClient(),
+	}
+}
+
+// Do - send a request to the heroku api.
+// Requests are paced when the rate limit runs low and retried on 429 (and 503 for
+// idempotent methods) with jittered exponential backoff honoring Retry-After.
+// [method] - http method
+// [path] - resource path relative to the api base url
+// [body] - json encodable request body, nil for none
+func (c *APIClient) Do(method, path string, body interface{}) (*http.Response, error) {
+	return c.do(method, path, body, nil)
+}
+
+func (c *APIClient) do(method, path string, body interface{}, header http.Header) (*http.Response, error) {
+	var payload []byte
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		payload = b
+	}
+
+	refreshed := false
+
+	for attempt := 0; ; attempt++ {
+		if d := rateLimit.delay(); d > 0 {
+			sleep(d)
+		}
+
+		var reader io.Reader
+		if payload != nil {
+			reader = bytes.NewReader(payload)
+		}
+
+		req, err := http.NewRequest(method, c.BaseURL+path, reader)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		rateLimit.update(resp.Header)
+
+		// an expired login is refreshed once, the request is then resent with the new token.
+		// Other tokens are simply rejected, a failed refresh says why instead of the 401.
+		if resp.StatusCode == http.StatusUnauthorized && c.Token != "" && !refreshed {
+			refreshed = true
+
+			token, err := refreshRejected(c.Token)
+			if err != errNotRefreshable {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+
+				if err != nil {
+					return nil, err
+				}
+
+				c.Token = token
+				continue
+			}
+		}
+
+		if attempt >= maxRetries || !shouldRetry(method, resp.StatusCode) {
+			return resp, nil
+		}
+
+		wait := backoff(attempt)
+		if ra, ok := retryAfter(resp.Header); ok && ra > wait {
+			wait = ra
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		sleep(wait)
+	}
+}
+
+// shouldRetry - a 429 is never processed so it is always safe to resend,
+// a 503 may have been partially applied so only idempotent methods are retried
+func shouldRetry(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return isIdempotent(method)
+	}
+
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+
+	return false
+}
+
+// backoff - full jitter exponential backoff for the given attempt
+func backoff(attempt int) time.Duration {
+	d := backoffBase << uint(attempt)
+	if d > backoffCap || d <= 0 {
+		d = backoffCap
+	}
+
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// retryAfter - parse a Retry-After header given in seconds or as an http date
+func retryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+
+	return 0, false
+}
+
+// ListRange - sort and order control for list endpoints
+type ListRange struct {
+	// Field - attribute to sort by e.g. name, version, created_at
+	Field string
+	// Order - asc or desc
+	Order string
+	// Max - page size, heroku defaults to 200
+	Max int
+}
+
+// header - render the range as a Range header value
+func (r ListRange) header() string {
+	field := r.Field
+	if field == "" {
+		field = "id"
+	}
+
+	v := field + " .."
+
+	var params []string
+	if r.Max > 0 {
+		max := r.Max
+		if max > maxPageSize {
+			max = maxPageSize
+		}
+		params = append(params, fmt.Sprintf("max=%d", max))
+	}
+	if r.Order != "" {
+		params = append(params, "order="+r.Order)
+	}
+
+	for i, p := range params {
+		if i == 0 {
+			v += "; " + p
+			continue
+		}
+		v += ", " + p
+	}
+
+	return v
+}
+
+// List - fetch every page of a list endpoint by following Next-Range
+// [path] - resource path relative to the api base url
+// [rng] - sort field, order and page size
+// [out] - pointer to a slice the combined results are decoded into
+func (c *APIClient) List(path string, rng ListRange, out interface{}) error {
+	var items []json.RawMessage
+	next := rng.header()
+
+	for next != "" {
+		resp, err := c.do("GET", path, nil, http.Header{"Range": []string{next}})
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != 200 && resp.StatusCode != 206 {
+			resp.Body.Close()
+			if resp.StatusCode == 401 {
+				return errors.New("client is not authorized")
+			}
+			return errors.New("error fetching resource")
+		}
+
+		var page []json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		items = append(items, page...)
+
+		// a 200 marks the last page, 206 means more results are available
+		next = ""
+		if resp.StatusCode == 206 {
+			next = resp.Header.Get("Next-Range")
+		}
+	}
+
+	b, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIClientRetry(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	t.Log("Should retry a throttled request honoring Retry-After")
+	{
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("RateLimit-Remaining", "4321")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		client := NewAPIClient(actk)
+		client.BaseURL = srv.URL
+
+		resp, err := client.Do("PATCH", "/apps/otter/config-vars", map[string]string{"PORT": "80"})
+		if err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
+		}
+
+		if resp.StatusCode != 200 || calls != 2 {
+			t.Fatalf("\t%s\tShould succeed on the second attempt: status %d after %d calls", failed, resp.StatusCode, calls)
+		}
+
+		if len(waits) == 0 || waits[len(waits)-1] < 7*time.Second {
+			t.Fatalf("\t%s\tShould wait at least the Retry-After delay: %v", failed, waits)
+		}
+
+		if remaining, ok := CurrentRateLimit().Remaining(); !ok || remaining != 4321 {
+			t.Fatalf("\t%s\tShould track the remaining budget: %d", failed, remaining)
+		}
+
+		t.Logf("\t%s\tShould retry a throttled request honoring Retry-After", succeed)
+	}
+
+	t.Log("Should not retry a non-idempotent request on 503")
+	{
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		client := NewAPIClient(actk)
+		client.BaseURL = srv.URL
+
+		resp, err := client.Do("POST", "/apps", nil)
+		if err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
+		}
+
+		if resp.StatusCode != 503 || calls != 1 {
+			t.Fatalf("\t%s\tShould give up after one attempt: %d calls", failed, calls)
+		}
+
+		t.Logf("\t%s\tShould not retry a non-idempotent request on 503", succeed)
+	}
+}
+
+func TestAPIClientList(t *testing.T) {
+	t.Log("Should follow Next-Range until the last page")
+	{
+		var ranges []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if len(ranges) == 1 {
+				w.Header().Set("Next-Range", "]otter-1..; max=1, order=asc")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(`[{"name":"otter-1"}]`))
+				return
+			}
+			w.Write([]byte(`[{"name":"otter-2"}]`))
+		}))
+		defer srv.Close()
+
+		client := NewAPIClient(actk)
+		client.BaseURL = srv.URL
+
+		var apps []struct {
+			Name string `json:"name"`
+		}
+		if err := client.List("/apps", ListRange{Field: "name", Order: "asc", Max: 1}, &apps); err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
+		}
+
+		if len(apps) != 2 || apps[1].Name != "otter-2" {
+			t.Fatalf("\t%s\tShould combine every page: %v", failed, apps)
+		}
+
+		if ranges[0] != "name ..; max=1, order=asc" || ranges[1] != "]otter-1..; max=1, order=asc" {
+			t.Fatalf("\t%s\tShould send the requested and next ranges: %v", failed, ranges)
+		}
+
+		t.Logf("\t%s\tShould follow Next-Range until the last page", succeed)
+	}
+}
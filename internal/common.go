@@ -14,17 +14,56 @@ import (
 	"strings"
 	"time"
 
-	"github.com/alexeyco/simpletable"
 	yaml "github.com/goccy/go-yaml"
-	"github.com/theckman/yacspin"
 )
 
-// PERMISSION - file mode
-const PERMISSION os.FileMode = 0777
+// DIR_PERMISSION - config directories are private to the user
+const DIR_PERMISSION os.FileMode = 0700
 
-//CONFIG_PATH - otter config location
+// FILE_PERMISSION - config files are readable and writable by the user only
+const FILE_PERMISSION os.FileMode = 0600
+
+// CONFIG_PATH - otter config location
 const CONFIG_PATH string = "/.config/otter"
 
+// AUTH_URL - otter auth relay server
+const AUTH_URL string = "https://otter-api-server.herokuapp.com"
+
+// REFRESH_MARGIN - access tokens are refreshed this long before they expire
+const REFRESH_MARGIN = 5 * time.Minute
+
+// ConfigDir - otter config location, OTTER_CONFIG_DIR overrides the default in the home directory
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("OTTER_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return homeDir + CONFIG_PATH, nil
+}
+
+// APIURL - heroku api base url, OTTER_API_URL points otter at another server e.g. a local fake
+func APIURL() string {
+	if uri := os.Getenv("OTTER_API_URL"); uri != "" {
+		return strings.TrimSuffix(uri, "/")
+	}
+
+	return API_URL
+}
+
+// AuthURL - auth relay base url, OTTER_AUTH_URL points otter at another relay
+func AuthURL() string {
+	if uri := os.Getenv("OTTER_AUTH_URL"); uri != "" {
+		return strings.TrimSuffix(uri, "/")
+	}
+
+	return AUTH_URL
+}
+
 // OpenURLLink - opens specified url in default os browser
 func OpenURLLink(url string) error {
 	var cmd string // os-specific command to launch browser
@@ -46,107 +85,174 @@ func OpenURLLink(url string) error {
 
 // TokenPair - pair of access and refresh tokens
 type TokenPair struct {
-	AccessToken  string
-	RefreshToken string
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// ExpiresAt - when the access token expires, zero when unknown
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// Scopes - oauth scopes granted to the access token, empty when unknown
+	Scopes []string `json:"scopes,omitempty"`
+	// ClientID - self-hosted oauth client that issued the tokens, empty for logins through the relay.
+	// Refreshes go back to the issuing client, whatever is configured now.
+	ClientID string `json:"client_id,omitempty"`
+	// Source - where the tokens came from, see the SOURCE_ constants
+	Source string `json:"-"`
 }
 
-// GetAuthTokens - fetch auth tokens from local conf
-func GetAuthTokens() (*TokenPair, error) {
-	var tokens *TokenPair
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+// Expired - the access token expires within REFRESH_MARGIN. Tokens without a known expiry
+// are assumed valid, an api call rejecting them triggers a refresh instead.
+func (t *TokenPair) Expired() bool {
+	if t.ExpiresAt.IsZero() {
+		return false
 	}
 
-	byt, err := ioutil.ReadFile(homeDir + CONFIG_PATH + "/.keys")
+	return time.Until(t.ExpiresAt) < REFRESH_MARGIN
+}
 
+// loginTokens - fetch auth tokens saved by otter auth, refreshing them shortly before they expire
+func loginTokens() (*TokenPair, error) {
+	store, err := CurrentTokenStore()
 	if err != nil {
 		return nil, err
 	}
 
-	content := string(byt)
-	lines := strings.Split(content, "\n")
-
-	if !strings.HasPrefix(lines[0], "access_token=") {
-		return nil, errors.New("no auth token found")
-	}
-
-	if !strings.HasPrefix(lines[1], "refresh_token=") {
-		return nil, errors.New("no auth token found")
+	tokens, err := store.Load(activeProfile)
+	if err != nil {
+		return nil, err
 	}
 
-	accessToken := strings.Split(lines[0], "=")[1]
-	refreshToken := strings.Split(lines[1], "=")[1]
+	tokens.Source = SOURCE_LOGIN
 
-	if isTokenValid := VerifyAuthToken(accessToken); isTokenValid {
-		tokens = &TokenPair{
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-		}
+	if !tokens.Expired() {
 		return tokens, nil
 	}
 
-	tokens, err = UpdateAuthorization(refreshToken)
+	tokens, err = UpdateAuthorization(tokens)
 	if err != nil {
-		return nil, errors.New("authorization failed")
+		return nil, fmt.Errorf("couldn't refresh the login - %s", err.Error())
 	}
 
 	return tokens, nil
 }
 
-// VerifyAuthToken - check if provided token is valid
-// [token] - access token
-func VerifyAuthToken(token string) bool {
-	url := "https://api.heroku.com/apps"
-	client := &http.Client{}
+// errNotRefreshable - the rejected token isn't the access token of an otter login e.g. an api key
+var errNotRefreshable = errors.New("token wasn't issued by otter auth")
 
-	req, err := http.NewRequest("GET", url, nil)
+// refreshRejected - refresh the login of the active profile after the api rejected its access token.
+// Tokens that didn't come from otter auth e.g. api keys can't be refreshed: errNotRefreshable.
+// [token] - access token the api rejected
+func refreshRejected(token string) (string, error) {
+	store, err := CurrentTokenStore()
 	if err != nil {
-		return false
+		return "", errNotRefreshable
 	}
 
-	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
+	tokens, err := store.Load(activeProfile)
+	if err != nil || tokens.AccessToken != token || tokens.RefreshToken == "" {
+		return "", errNotRefreshable
+	}
 
+	tokens, err = UpdateAuthorization(tokens)
 	if err != nil {
-		return false
+		return "", fmt.Errorf("couldn't refresh the login - %s", err.Error())
 	}
 
-	return resp.StatusCode == 200
+	return tokens.AccessToken, nil
 }
 
-// PersistAuthorization - save auth tokens to user system
+// PersistAuthorization - save auth tokens of the active profile to the token store
 // [at] - access token
 // [rt] - refresh token
 func PersistAuthorization(at string, rt string) error {
-	homeDir, err := os.UserHomeDir()
+	return PersistTokens(&TokenPair{
+		AccessToken:  at,
+		RefreshToken: rt,
+	})
+}
+
+// PersistTokens - save auth tokens of the active profile, including their expiry, to the token store
+// [tokens] - tokens to save
+func PersistTokens(tokens *TokenPair) error {
+	store, err := CurrentTokenStore()
 	if err != nil {
 		return err
 	}
 
-	content := fmt.Sprintf("access_token=%s\nrefresh_token=%s", at, rt)
+	return store.Save(activeProfile, tokens)
+}
+
+// CanWrite - whether the scopes allow changes to apps, assumed when the scopes are unknown e.g. api keys
+func (t *TokenPair) CanWrite() bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
 
-	err = ioutil.WriteFile(homeDir+CONFIG_PATH+"/.keys", []byte(content), os.FileMode(PERMISSION))
+	for _, scope := range t.Scopes {
+		if writeScopes[scope] {
+			return true
+		}
+	}
 
-	if !os.IsNotExist(err) {
-		return err
+	return false
+}
+
+// RequireWrite - refuse a change with read-only credentials
+func (t *TokenPair) RequireWrite() error {
+	if t.CanWrite() {
+		return nil
+	}
+
+	return fmt.Errorf("profile %s is logged in read-only (%s) - log in with otter auth --scope write-protected to make changes", activeProfile, strings.Join(t.Scopes, " "))
+}
+
+// StoredTokens - tokens saved by otter auth for the active profile, as they are without refreshing them
+func StoredTokens() (*TokenPair, error) {
+	store, err := CurrentTokenStore()
+	if err != nil {
+		return nil, err
 	}
 
-	// create config path
-	err = os.Mkdir(homeDir+CONFIG_PATH, os.FileMode(PERMISSION))
+	return store.Load(activeProfile)
+}
 
-	err = ioutil.WriteFile(homeDir+CONFIG_PATH+"/.keys", []byte(content), os.FileMode(PERMISSION))
+// storedScopes - scopes recorded for the active profile, kept across refreshes
+func storedScopes() []string {
+	tokens, err := StoredTokens()
+	if err != nil {
+		return nil
+	}
 
-	return err
+	return tokens.Scopes
 }
 
-// UpdateAuthorization - get new access_token from refresh token
-func UpdateAuthorization(refreshToken string) (*TokenPair, error) {
+// ExpiresAt - expiry of a token issued now for expires_in seconds, zero when the lifetime is unknown
+// [expiresIn] - expires_in field of an oauth token response
+func ExpiresAt(expiresIn interface{}) time.Time {
+	seconds, ok := expiresIn.(float64)
+	if !ok || seconds <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(seconds) * time.Second).UTC().Truncate(time.Second)
+}
+
+// UpdateAuthorization - get a new access token with the refresh token of a login,
+// from the self-hosted client that issued it or else the relay
+// [login] - saved tokens of the login
+func UpdateAuthorization(login *TokenPair) (*TokenPair, error) {
 	var tokens TokenPair
-	// uri := fmt.Sprintf("http://localhost:5000/auth/refresh")
-	uri := fmt.Sprintf("https://otter-api-server.herokuapp.com/auth/refresh")
+	refreshToken := login.RefreshToken
+
+	// tokens of a self-hosted client can only be refreshed with its own secret
+	if login.ClientID != "" {
+		client := LocalOAuthClient()
+		if client == nil || client.ID != login.ClientID {
+			return nil, fmt.Errorf("profile %s was logged in with oauth client %s, which is no longer configured - configure it again or log in with otter auth", activeProfile, login.ClientID)
+		}
+
+		return client.Refresh(refreshToken)
+	}
+
+	uri := fmt.Sprintf("%s/auth/refresh", AuthURL())
 
 	body, err := json.Marshal(map[string]interface{}{
 		"refresh_token": refreshToken,
@@ -158,8 +264,9 @@ func UpdateAuthorization(refreshToken string) (*TokenPair, error) {
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := HTTPClient()
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -168,8 +275,17 @@ func UpdateAuthorization(refreshToken string) (*TokenPair, error) {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("too many token refreshes - try again in %ss", resp.Header.Get("Retry-After"))
+	}
+
+	// heroku refused the refresh token, only a new login helps
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusBadRequest {
+		return nil, errors.New("the login has expired or was revoked - log in again with otter auth")
+	}
+
 	if resp.StatusCode != 200 {
-		return nil, errors.New("authorization failed")
+		return nil, fmt.Errorf("the relay responded %d - try again later", resp.StatusCode)
 	}
 
 	var data map[string]interface{}
@@ -184,49 +300,162 @@ func UpdateAuthorization(refreshToken string) (*TokenPair, error) {
 		return nil, errors.New("authorization failed")
 	}
 
-	accessToken := data["access_token"].(string)
-	refreshToken = data["refresh_token"].(string)
+	tokens.AccessToken = data["access_token"].(string)
+	if rt, ok := data["refresh_token"].(string); ok && rt != "" {
+		tokens.RefreshToken = rt
+	} else {
+		tokens.RefreshToken = refreshToken
+	}
+	tokens.ExpiresAt = ExpiresAt(data["expires_in"])
+	tokens.Scopes = storedScopes()
 
-	if err := PersistAuthorization(accessToken, refreshToken); err != nil {
+	if err := PersistTokens(&tokens); err != nil {
 		return nil, err
 	}
 
-	tokens.AccessToken = accessToken
-	tokens.RefreshToken = refreshToken
+	tokens.Source = SOURCE_LOGIN
 
 	return &tokens, nil
 }
 
-// RevokeAuthorization - invalidate all tokens from user system
+// ErrLoginRejected - the relay refused a login session for good e.g. it expired or was already used
+var ErrLoginRejected = errors.New("authorization failed")
+
+// PollLoginSession - ask the relay whether a headless login has completed, saving its tokens when it has.
+// Errors other than ErrLoginRejected e.g. a network blip, a 5xx or a 429 are worth retrying.
+// [secret] - session secret from NewLoginSession
+func PollLoginSession(secret string) (*TokenPair, error) {
+	body, err := json.Marshal(map[string]string{
+		"session_secret": secret,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := HTTPClient().Post(AuthURL()+"/auth/session", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		return nil, nil
+	}
+
+	if resp.StatusCode != 200 {
+		// the relay answers 4xx for unknown, used or expired sessions, anything else may pass
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, ErrLoginRejected
+		}
+
+		return nil, fmt.Errorf("relay responded %d", resp.StatusCode)
+	}
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	accessToken, _ := data["access_token"].(string)
+	if accessToken == "" {
+		return nil, errors.New("authorization failed")
+	}
+
+	refreshToken, _ := data["refresh_token"].(string)
+	scope, _ := data["scope"].(string)
+
+	tokens := &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    ExpiresAt(data["expires_in"]),
+		Scopes:       strings.Fields(scope),
+	}
+
+	if err := PersistTokens(tokens); err != nil {
+		return nil, err
+	}
+
+	tokens.Source = SOURCE_LOGIN
+
+	return tokens, nil
+}
+
+// RevokeAuthorization - revoke the oauth authorization of the otter login and clear its tokens
 func RevokeAuthorization() error {
-	homeDir, err := os.UserHomeDir()
-	tokens, err := GetAuthTokens()
+	tokens, err := loginTokens()
 	if err != nil {
 		return err
 	}
 
-	uri := fmt.Sprintf("https://api.heroku.com/authorizations/%s", tokens.AccessToken)
-	req, err := http.NewRequest("DELETE", uri, nil)
+	id, err := AuthorizationID(tokens.AccessToken)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
-	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	client := NewAPIClient(tokens.AccessToken)
 
-	client := http.Client{}
-	resp, err := client.Do(req)
+	resp, err := client.Do("DELETE", fmt.Sprintf("/oauth/authorizations/%s", id), nil)
 	if err != nil {
 		return err
 	}
 
-	if resp.StatusCode == 200 {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
 		return errors.New("failed to revoke authorization")
 	}
 
-	err = ioutil.WriteFile(homeDir+CONFIG_PATH+"/.keys", []byte(""), os.FileMode(PERMISSION))
+	return ClearAuthorization()
+}
 
-	return err
+// AuthorizationID - id of the oauth authorization an access token belongs to
+// [token] - access token
+func AuthorizationID(token string) (string, error) {
+	var authorizations []struct {
+		ID          string `json:"id"`
+		AccessToken *struct {
+			Token string `json:"token"`
+		} `json:"access_token"`
+	}
+
+	if err := NewAPIClient(token).List("/oauth/authorizations", ListRange{}, &authorizations); err != nil {
+		return "", err
+	}
+
+	for _, a := range authorizations {
+		if a.AccessToken != nil && a.AccessToken.Token == token {
+			return a.ID, nil
+		}
+	}
+
+	return "", errors.New("couldn't find the authorization of the current token")
+}
+
+// IsLoginToken - the access token is the one otter auth saved for the active profile
+// [token] - access token
+func IsLoginToken(token string) bool {
+	store, err := CurrentTokenStore()
+	if err != nil {
+		return false
+	}
+
+	tokens, err := store.Load(activeProfile)
+	if err != nil {
+		return false
+	}
+
+	return tokens.AccessToken == token
+}
+
+// ClearAuthorization - remove the tokens of the active profile from the token store
+func ClearAuthorization() error {
+	store, err := CurrentTokenStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Delete(activeProfile)
 }
 
 // ParseEnv - convert env file to map structure
@@ -294,61 +523,3 @@ func ParseJSON(path string) (map[string]string, error) {
 
 	return out, nil
 }
-
-// LoadingSpinner - show loading spinner
-func LoadingSpinner() (*yacspin.Spinner, error) {
-	config := yacspin.Config{
-		Frequency:         100 * time.Millisecond,
-		CharSet:           yacspin.CharSets[69],
-		Prefix:            "Please wait... ",
-		Message:           "",
-		StopCharacter:     "✓",
-		StopFailMessage:   "",
-		StopFailCharacter: "✗",
-		StopFailColors:    []string{"fgRed"},
-		StopColors:        []string{"fgGreen"},
-	}
-
-	spinner, err := yacspin.New(config)
-	if err != nil {
-		return nil, err
-	}
-
-	return spinner, nil
-}
-
-// GenerateDataTable - create a structure table to display dataset
-// [dataset] - data to be rendered
-func GenerateDataTable(dataset []interface{}) (*simpletable.Table, error) {
-	table := simpletable.New()
-
-	switch dataset[0].(type) {
-	// NOTE: not very satisfied with this case value. it's very generic and wille easily break.
-	case map[string]interface{}:
-		table.Header = &simpletable.Header{
-			Cells: []*simpletable.Cell{
-				{Align: simpletable.AlignCenter, Text: "#"},
-				{Align: simpletable.AlignCenter, Text: "Key"},
-				{Align: simpletable.AlignCenter, Text: "Value"},
-			},
-		}
-
-		for i, v := range dataset {
-			data := v.(map[string]interface{})
-			r := []*simpletable.Cell{
-				{Align: simpletable.AlignLeft, Text: fmt.Sprintf("%d", i)},
-				{Align: simpletable.AlignLeft, Text: fmt.Sprintf("%s", data["key"])},
-				{Align: simpletable.AlignLeft, Text: fmt.Sprintf("%s", data["value"])},
-			}
-
-			table.Body.Cells = append(table.Body.Cells, r)
-		}
-
-	default:
-		return nil, errors.New("invalid type for dataset")
-	}
-
-	table.SetStyle(simpletable.StyleMarkdown)
-
-	return table, nil
-}
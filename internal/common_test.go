@@ -1,6 +1,14 @@
 package internal
 
-import "testing"
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Mayowa-Ojo/otter/internal/fakeheroku"
+)
 
 const (
 	succeed = "\u2713"
@@ -9,6 +17,26 @@ const (
 	rftk    = "e773c02c-15d8-42c5-8b96-ar3a27364700"
 )
 
+// TestMain - run against a fake heroku api and a throwaway config directory
+func TestMain(m *testing.M) {
+	srv := httptest.NewServer(fakeheroku.New())
+	dir, err := ioutil.TempDir("", "otter")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Setenv("OTTER_API_URL", srv.URL)
+	os.Setenv("OTTER_AUTH_URL", srv.URL)
+	os.Setenv("OTTER_CONFIG_DIR", dir+"/otter")
+	os.Setenv("OTTER_TOKEN_STORE", STORE_FILE)
+
+	code := m.Run()
+
+	srv.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestPersistAuthorization(t *testing.T) {
 	t.Log("Should save auth tokens to config file in home directory")
 	{
@@ -20,17 +48,124 @@ func TestPersistAuthorization(t *testing.T) {
 	}
 }
 
-func TestVerifyAuthToken(t *testing.T) {
-	t.Log("Should return false for an invalid token")
+func TestProfiles(t *testing.T) {
+	defer SetProfile(DEFAULT_PROFILE)
+
+	t.Log("Should keep tokens of each profile apart")
 	{
-		token := "007235f4-d5a0-4d75-s354-b20a65e6b87v"
+		if err := PersistAuthorization(actk, rftk); err != nil {
+			t.Fatalf("\t%s\tShould save default tokens: %v", failed, err)
+		}
+
+		if err := SetProfile("client-x"); err != nil {
+			t.Fatalf("\t%s\tShould accept a valid profile name: %v", failed, err)
+		}
+
+		if err := PersistAuthorization("client-access", "client-refresh"); err != nil {
+			t.Fatalf("\t%s\tShould save profile tokens: %v", failed, err)
+		}
 
-		isValid := VerifyAuthToken(token)
+		store, _ := CurrentTokenStore()
+		tokens, err := store.Load("client-x")
+		if err != nil || tokens.AccessToken != "client-access" {
+			t.Fatalf("\t%s\tShould store the profile's own tokens: %v", failed, err)
+		}
+
+		profiles, err := ListProfiles()
+		if err != nil || strings.Join(profiles, ",") != "client-x,default" {
+			t.Fatalf("\t%s\tShould list both profiles: %v %v", failed, profiles, err)
+		}
+
+		t.Logf("\t%s\tShould keep tokens of each profile apart", succeed)
+	}
+
+	t.Log("Should reject profile names that escape the config directory")
+	{
+		if err := SetProfile("../other"); err == nil {
+			t.Fatalf("\t%s\tShould return an error", failed)
+		}
+
+		t.Logf("\t%s\tShould reject profile names that escape the config directory", succeed)
+	}
+}
+
+func TestAPIKeyCredentials(t *testing.T) {
+	defer SetProfile(DEFAULT_PROFILE)
+
+	t.Log("Should fall back to HEROKU_API_KEY without an otter login")
+	{
+		SetProfile("ci")
+		os.Setenv("HEROKU_API_KEY", fakeheroku.AccessToken)
+		defer os.Unsetenv("HEROKU_API_KEY")
 
-		if !isValid {
-			t.Logf("\t%s\ttoken is invalid", succeed)
-		} else {
-			t.Fatalf("\t%s\ttoken is valid", failed)
+		tokens, err := GetAuthTokens()
+		if err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
 		}
+
+		if tokens.AccessToken != fakeheroku.AccessToken || tokens.Source != SOURCE_HEROKU_API_KEY {
+			t.Fatalf("\t%s\tShould use the api key: %+v", failed, tokens)
+		}
+
+		t.Logf("\t%s\tShould fall back to HEROKU_API_KEY without an otter login", succeed)
+	}
+
+	t.Log("Should read the api.heroku.com entry from netrc")
+	{
+		content := "machine git.heroku.com\n  login me@example.com\n  password git-token\n" +
+			"machine api.heroku.com\n  login me@example.com\n  password api-token\n"
+
+		if password := parseNetrc(content, "api.heroku.com"); password != "api-token" {
+			t.Fatalf("\t%s\tShould find the api token: %q", failed, password)
+		}
+
+		t.Logf("\t%s\tShould read the api.heroku.com entry from netrc", succeed)
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otter-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Log("Should migrate plaintext keys into a private encrypted file")
+	{
+		legacy := dir + KEYS_FILE
+		if err := ioutil.WriteFile(legacy, []byte("access_token="+actk+"\nrefresh_token="+rftk), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		configDir := os.Getenv("OTTER_CONFIG_DIR")
+		os.Setenv("OTTER_CONFIG_DIR", dir)
+		defer os.Setenv("OTTER_CONFIG_DIR", configDir)
+
+		store := &fileStore{dir: dir}
+		if err := migrateLegacyKeys(store); err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
+		}
+
+		if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+			t.Fatalf("\t%s\tShould remove the plaintext file", failed)
+		}
+
+		tokens, err := store.Load(DEFAULT_PROFILE)
+		if err != nil || tokens.AccessToken != actk || tokens.RefreshToken != rftk {
+			t.Fatalf("\t%s\tShould keep the migrated tokens: %v", failed, err)
+		}
+
+		byt, _ := ioutil.ReadFile(dir + CREDENTIALS_FILE)
+		if strings.Contains(string(byt), actk) {
+			t.Fatalf("\t%s\tShould encrypt the tokens", failed)
+		}
+
+		for path, mode := range map[string]os.FileMode{dir: DIR_PERMISSION, dir + CREDENTIALS_FILE: FILE_PERMISSION, dir + CREDENTIALS_KEY_FILE: FILE_PERMISSION} {
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != mode {
+				t.Fatalf("\t%s\tShould restrict %s to %v", failed, path, mode)
+			}
+		}
+
+		t.Logf("\t%s\tShould migrate plaintext keys into a private encrypted file", succeed)
 	}
 }
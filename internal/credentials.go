@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// credential sources reported in TokenPair.Source
+const (
+	SOURCE_LOGIN          string = "otter login"
+	SOURCE_OTTER_TOKEN    string = "OTTER_TOKEN"
+	SOURCE_HEROKU_API_KEY string = "HEROKU_API_KEY"
+	SOURCE_NETRC          string = "netrc"
+)
+
+// CREDENTIALS_ENV_FIRST - settings value preferring api keys over the otter login
+const CREDENTIALS_ENV_FIRST string = "env-first"
+
+// netrcMachine - entry the heroku cli writes to ~/.netrc
+const netrcMachine = "api.heroku.com"
+
+// GetAuthTokens - fetch auth tokens for the active profile.
+// The otter login is used first, falling back to OTTER_TOKEN, HEROKU_API_KEY and the
+// api.heroku.com entry in ~/.netrc - the order flips with `credentials: env-first` in settings.
+func GetAuthTokens() (*TokenPair, error) {
+	envFirst := false
+	if settings, err := LoadSettings(); err == nil {
+		envFirst = settings.Credentials == CREDENTIALS_ENV_FIRST
+	}
+
+	if envFirst {
+		if tokens := apiKeyTokens(); tokens != nil {
+			return tokens, nil
+		}
+	}
+
+	tokens, err := loginTokens()
+	if err == nil {
+		return tokens, nil
+	}
+
+	if !envFirst {
+		if tokens := apiKeyTokens(); tokens != nil {
+			return tokens, nil
+		}
+	}
+
+	return nil, err
+}
+
+// apiKeyTokens - long-lived api key from the environment or ~/.netrc, nil when none is set.
+// These keys are never refreshed so the pair has no refresh token.
+func apiKeyTokens() *TokenPair {
+	if token := strings.TrimSpace(os.Getenv("OTTER_TOKEN")); token != "" {
+		return &TokenPair{AccessToken: token, Source: SOURCE_OTTER_TOKEN}
+	}
+
+	if token := strings.TrimSpace(os.Getenv("HEROKU_API_KEY")); token != "" {
+		return &TokenPair{AccessToken: token, Source: SOURCE_HEROKU_API_KEY}
+	}
+
+	if token := netrcPassword(netrcMachine); token != "" {
+		return &TokenPair{AccessToken: token, Source: SOURCE_NETRC}
+	}
+
+	return nil
+}
+
+// netrcPassword - password of a machine entry in ~/.netrc (or $NETRC)
+// [machine] - host name of the entry
+func netrcPassword(machine string) string {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		path = filepath.Join(homeDir, ".netrc")
+	}
+
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return parseNetrc(string(byt), machine)
+}
+
+// parseNetrc - find the password of a machine in netrc content
+func parseNetrc(content, machine string) string {
+	var current, password string
+	var inMacro bool
+
+	for _, line := range strings.Split(content, "\n") {
+		// macro definitions run until the next blank line
+		if inMacro {
+			if strings.TrimSpace(line) == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				if current == machine && password != "" {
+					return password
+				}
+				current, password = "", ""
+				if i+1 < len(fields) {
+					current = fields[i+1]
+					i++
+				}
+			case "default":
+				if current == machine && password != "" {
+					return password
+				}
+				current, password = "", ""
+			case "password":
+				if i+1 < len(fields) {
+					password = fields[i+1]
+					i++
+				}
+			case "login", "account":
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+
+	if current == machine {
+		return password
+	}
+
+	return ""
+}
@@ -0,0 +1,965 @@
+// Package fakeheroku - in-memory stand-in for the heroku platform api and the otter auth relay,
+// used by tests and for offline demos (see OTTER_API_URL and OTTER_AUTH_URL)
+package fakeheroku
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// AccessToken - access token accepted by a new fake
+	AccessToken = "fake-access-token"
+	// RefreshToken - refresh token accepted by a new fake
+	RefreshToken = "fake-refresh-token"
+	// Email - account email of the fake user
+	Email = "otter@example.com"
+	// LoginAuthorizationID - id of the authorization the otter login tokens belong to
+	LoginAuthorizationID = "01234567-89ab-cdef-0123-456789abcdef"
+	// ClientID - oauth client accepted by /oauth/authorize and /oauth/token
+	ClientID = "fake-client-id"
+	// ClientSecret - secret of ClientID
+	ClientSecret = "fake-client-secret"
+
+	rateLimitBudget = 4500
+	defaultPageSize = 200
+)
+
+// App - fake app state
+type App struct {
+	ID            string
+	Name          string
+	Region        string
+	Stack         string
+	ConfigVars    map[string]string
+	Releases      []map[string]interface{}
+	Builds        []map[string]interface{}
+	Collaborators []map[string]interface{}
+	Attachments   []map[string]interface{}
+	Formation     map[string]map[string]interface{}
+	CreatedAt     time.Time
+}
+
+// authorization - oauth authorization of the fake user, the login one holds the current token pair
+type authorization struct {
+	ID          string
+	Description string
+	Scope       []string
+	Token       string
+	CreatedAt   time.Time
+	login       bool
+}
+
+type failure struct {
+	method string
+	path   string
+	status int
+	header http.Header
+	times  int
+}
+
+// Fake - in-memory heroku api, safe for concurrent use
+type Fake struct {
+	mu           sync.Mutex
+	router       *mux.Router
+	apps         map[string]*App
+	failures     []*failure
+	requests     []string
+	accessToken  string
+	refreshToken string
+	remaining    int
+	seq          int
+	// grants - pending authorization codes with the pkce challenge they were issued for
+	grants map[string]string
+	// sessions - scopes of the relay logins the user has authorized, by session id
+	sessions map[string]string
+	// authorizations - oauth authorizations, the first one belongs to the otter login
+	authorizations []*authorization
+}
+
+// New - create a fake with a single authorized user and no apps
+func New() *Fake {
+	f := &Fake{
+		apps:         map[string]*App{},
+		accessToken:  AccessToken,
+		refreshToken: RefreshToken,
+		remaining:    rateLimitBudget,
+		grants:       map[string]string{},
+		sessions:     map[string]string{},
+		authorizations: []*authorization{
+			{ID: LoginAuthorizationID, Description: "otter", Scope: []string{"read-protected", "write-protected"}, CreatedAt: time.Now().UTC(), login: true},
+		},
+	}
+
+	r := mux.NewRouter()
+
+	r.HandleFunc("/auth", f.handleRelayAuth).Methods("GET")
+	r.HandleFunc("/auth/refresh", f.handleRelayRefresh).Methods("POST")
+	r.HandleFunc("/auth/session", f.handleRelaySession).Methods("POST")
+	r.HandleFunc("/auth/success", f.handleRelaySuccess).Methods("GET")
+	r.HandleFunc("/oauth/authorize", f.handleOauthAuthorize).Methods("GET")
+	r.HandleFunc("/oauth/token", f.handleOauthToken).Methods("POST")
+
+	api := r.NewRoute().Subrouter()
+	api.Use(f.authorize)
+	api.HandleFunc("/account", f.handleAccount).Methods("GET")
+	api.HandleFunc("/account/rate-limits", f.handleRateLimit).Methods("GET")
+	api.HandleFunc("/oauth/authorizations", f.handleListAuthorizations).Methods("GET")
+	api.HandleFunc("/oauth/authorizations", f.handleCreateAuthorization).Methods("POST")
+	api.HandleFunc("/oauth/authorizations/{id}", f.handleGetAuthorization).Methods("GET")
+	api.HandleFunc("/oauth/authorizations/{id}", f.handleRevoke).Methods("DELETE")
+	api.HandleFunc("/oauth/authorizations/{id}/actions/regenerate-tokens", f.handleRegenerate).Methods("POST")
+	api.HandleFunc("/apps", f.handleListApps).Methods("GET")
+	api.HandleFunc("/apps/{app}", f.handleGetApp).Methods("GET")
+	api.HandleFunc("/apps/{app}/config-vars", f.handleGetConfigVars).Methods("GET")
+	api.HandleFunc("/apps/{app}/config-vars", f.handleUpdateConfigVars).Methods("PATCH")
+	api.HandleFunc("/apps/{app}/releases", f.handleList(func(a *App) []map[string]interface{} { return a.Releases })).Methods("GET")
+	api.HandleFunc("/apps/{app}/builds", f.handleList(func(a *App) []map[string]interface{} { return a.Builds })).Methods("GET")
+	api.HandleFunc("/apps/{app}/collaborators", f.handleList(func(a *App) []map[string]interface{} { return a.Collaborators })).Methods("GET")
+	api.HandleFunc("/apps/{app}/addon-attachments", f.handleList(func(a *App) []map[string]interface{} { return a.Attachments })).Methods("GET")
+	api.HandleFunc("/apps/{app}/formation", f.handleList(formationList)).Methods("GET")
+	api.HandleFunc("/apps/{app}/formation", f.handleUpdateFormation).Methods("PATCH")
+	api.HandleFunc("/apps/{app}/formation/{type}", f.handleGetFormation).Methods("GET")
+
+	f.router = r
+
+	return f
+}
+
+// ServeHTTP - serve a request against the in-memory state
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	for i, fl := range f.failures {
+		if fl.method != r.Method || fl.path != r.URL.Path {
+			continue
+		}
+
+		fl.times--
+		if fl.times <= 0 {
+			f.failures = append(f.failures[:i], f.failures[i+1:]...)
+		}
+		f.mu.Unlock()
+
+		for k, v := range fl.header {
+			w.Header()[k] = v
+		}
+		writeError(w, fl.status, "scripted_failure", "scripted failure")
+		return
+	}
+	f.mu.Unlock()
+
+	f.router.ServeHTTP(w, r)
+}
+
+// AddApp - register an app owned by the fake user
+// [name] - app name
+func (f *Fake) AddApp(name string) *App {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	app := &App{
+		ID:         fmt.Sprintf("01234567-89ab-cdef-0123-%012d", f.seq),
+		Name:       name,
+		Region:     "us",
+		Stack:      "heroku-20",
+		ConfigVars: map[string]string{},
+		Formation: map[string]map[string]interface{}{
+			"web": {"type": "web", "quantity": 1, "size": "standard-1X"},
+		},
+		CreatedAt: time.Date(2021, 1, 1, 0, 0, f.seq, 0, time.UTC),
+	}
+	app.Collaborators = []map[string]interface{}{
+		{"id": app.ID, "role": "owner", "user": map[string]string{"email": Email}, "created_at": stamp(app.CreatedAt)},
+	}
+	f.apps[name] = app
+	f.release(app, "Initial release")
+
+	return app
+}
+
+// SetConfigVars - replace the config vars of an app without creating a release
+func (f *Fake) SetConfigVars(app string, vars map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.apps[app].ConfigVars = copyVars(vars)
+}
+
+// AddAttachment - attach an add-on to an app, its config vars are the ones prefixed by the attachment name
+// [name] - attachment name e.g. DATABASE
+// [addon] - add-on name e.g. postgresql-curved-12345
+func (f *Fake) AddAttachment(app, name, addon string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	a := f.apps[app]
+	a.Attachments = append(a.Attachments, map[string]interface{}{
+		"id":         fmt.Sprintf("01234567-89ab-cdef-0123-%012d", f.seq),
+		"name":       name,
+		"addon":      map[string]interface{}{"name": addon, "app": map[string]string{"name": app}},
+		"app":        map[string]string{"name": app},
+		"created_at": stamp(a.CreatedAt),
+	})
+}
+
+// ConfigVars - current config vars of an app
+func (f *Fake) ConfigVars(app string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return copyVars(f.apps[app].ConfigVars)
+}
+
+// Releases - number of releases created for an app
+func (f *Fake) Releases(app string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.apps[app].Releases)
+}
+
+// Fail - respond to the next requests matching method and path with an error
+// [status] - http status of the scripted failure
+// [times] - how many matching requests fail before the route recovers
+// [header] - optional response headers e.g. Retry-After
+func (f *Fake) Fail(method, path string, status, times int, header http.Header) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures = append(f.failures, &failure{method, path, status, header, times})
+}
+
+// SetRateLimit - set the remaining request budget
+func (f *Fake) SetRateLimit(remaining int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.remaining = remaining
+}
+
+// ExpireAccessToken - invalidate the current access token, the refresh token stays valid
+func (f *Fake) ExpireAccessToken() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.accessToken = fmt.Sprintf("%s-expired-%d", AccessToken, time.Now().UnixNano())
+}
+
+// Tokens - the access and refresh tokens currently accepted
+func (f *Fake) Tokens() (string, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.accessToken, f.refreshToken
+}
+
+// IssueTokens - grant a fresh otter login, e.g. after a test revoked the previous one
+func (f *Fake) IssueTokens() (string, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	f.accessToken = fmt.Sprintf("%s-%d", AccessToken, f.seq)
+	f.refreshToken = fmt.Sprintf("%s-%d", RefreshToken, f.seq)
+
+	if f.findAuthorization(LoginAuthorizationID) == nil {
+		f.authorizations = append(f.authorizations, &authorization{
+			ID:          LoginAuthorizationID,
+			Description: "otter",
+			Scope:       []string{"read-protected", "write-protected"},
+			CreatedAt:   time.Now().UTC(),
+			login:       true,
+		})
+	}
+
+	return f.accessToken, f.refreshToken
+}
+
+// Requests - every request received as "METHOD /path"
+func (f *Fake) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.requests...)
+}
+
+func (f *Fake) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		valid := f.validToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if f.remaining > 0 {
+			f.remaining--
+		}
+		remaining := f.remaining
+		f.mu.Unlock()
+
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("Request-Id", fmt.Sprintf("fake-%d", time.Now().UnixNano()))
+
+		if !valid {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid credentials provided.")
+			return
+		}
+
+		if remaining == 0 {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "rate_limit", "Your account reached the API rate limit")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *Fake) handleAccount(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":    "fake-user",
+		"email": Email,
+		"name":  "Otter",
+	})
+}
+
+func (f *Fake) handleRateLimit(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	remaining := f.remaining
+	f.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]int{"remaining": remaining})
+}
+
+func (f *Fake) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, a := range f.authorizations {
+		if a.ID != mux.Vars(r)["id"] {
+			continue
+		}
+
+		out := f.renderAuthorization(a)
+		f.authorizations = append(f.authorizations[:i], f.authorizations[i+1:]...)
+		if a.login {
+			f.accessToken = ""
+			f.refreshToken = ""
+		}
+
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "not_found", "Couldn't find that authorization.")
+}
+
+func (f *Fake) handleListAuthorizations(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := []map[string]interface{}{}
+	for _, a := range f.authorizations {
+		out = append(out, f.renderAuthorization(a))
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (f *Fake) handleCreateAuthorization(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Description string   `json:"description"`
+		Scope       []string `json:"scope"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Scope) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_params", "scope is required")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	a := &authorization{
+		ID:          fmt.Sprintf("fake-authorization-%d", f.seq),
+		Description: body.Description,
+		Scope:       body.Scope,
+		Token:       fmt.Sprintf("fake-authorization-token-%d", f.seq),
+		CreatedAt:   time.Now().UTC(),
+	}
+	f.authorizations = append(f.authorizations, a)
+
+	writeJSON(w, http.StatusCreated, f.renderAuthorization(a))
+}
+
+func (f *Fake) handleGetAuthorization(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a := f.findAuthorization(mux.Vars(r)["id"])
+	if a == nil {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that authorization.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, f.renderAuthorization(a))
+}
+
+func (f *Fake) handleRegenerate(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a := f.findAuthorization(mux.Vars(r)["id"])
+	if a == nil {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that authorization.")
+		return
+	}
+
+	f.seq++
+	if a.login {
+		f.accessToken = fmt.Sprintf("%s-%d", AccessToken, f.seq)
+		f.refreshToken = fmt.Sprintf("%s-%d", RefreshToken, f.seq)
+	} else {
+		a.Token = fmt.Sprintf("fake-authorization-token-%d", f.seq)
+	}
+
+	writeJSON(w, http.StatusOK, f.renderAuthorization(a))
+}
+
+// validToken - the token belongs to an authorization, callers hold the lock
+func (f *Fake) validToken(token string) bool {
+	if token == "" {
+		return false
+	}
+
+	if token == f.accessToken {
+		return true
+	}
+
+	for _, a := range f.authorizations {
+		if !a.login && a.Token == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findAuthorization - authorization by id, callers hold the lock
+func (f *Fake) findAuthorization(id string) *authorization {
+	for _, a := range f.authorizations {
+		if a.ID == id {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// renderAuthorization - api representation of an authorization, callers hold the lock
+func (f *Fake) renderAuthorization(a *authorization) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":           a.ID,
+		"description":  a.Description,
+		"scope":        a.Scope,
+		"created_at":   a.CreatedAt.Format(time.RFC3339),
+		"updated_at":   a.CreatedAt.Format(time.RFC3339),
+		"access_token": map[string]interface{}{"id": a.ID + "-token", "token": a.Token, "expires_in": nil},
+		"client":       nil,
+	}
+
+	if a.login {
+		out["access_token"] = map[string]interface{}{"id": a.ID + "-token", "token": f.accessToken, "expires_in": 28800}
+		out["refresh_token"] = map[string]interface{}{"id": a.ID + "-refresh", "token": f.refreshToken}
+		out["client"] = map[string]interface{}{"id": ClientID, "name": "otter"}
+	}
+
+	return out
+}
+
+func (f *Fake) handleListApps(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	var items []map[string]interface{}
+	for _, a := range f.apps {
+		items = append(items, appJSON(a))
+	}
+	f.mu.Unlock()
+
+	writePage(w, r, items, "name")
+}
+
+func (f *Fake) handleGetApp(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	app, ok := f.apps[mux.Vars(r)["app"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that app.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, appJSON(app))
+}
+
+func (f *Fake) handleGetConfigVars(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	app, ok := f.apps[mux.Vars(r)["app"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that app.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, app.ConfigVars)
+}
+
+func (f *Fake) handleUpdateConfigVars(w http.ResponseWriter, r *http.Request) {
+	var body map[string]*string
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	app, ok := f.apps[mux.Vars(r)["app"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that app.")
+		return
+	}
+
+	var changed []string
+	for k, v := range body {
+		if v == nil {
+			delete(app.ConfigVars, k)
+		} else {
+			app.ConfigVars[k] = *v
+		}
+		changed = append(changed, k)
+	}
+	sort.Strings(changed)
+
+	f.release(app, "Set "+strings.Join(changed, ", ")+" config vars")
+
+	writeJSON(w, http.StatusOK, app.ConfigVars)
+}
+
+func (f *Fake) handleList(list func(*App) []map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		app, ok := f.apps[mux.Vars(r)["app"]]
+		var items []map[string]interface{}
+		if ok {
+			items = append(items, list(app)...)
+		}
+		f.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, "not_found", "Couldn't find that app.")
+			return
+		}
+
+		writePage(w, r, items, "id")
+	}
+}
+
+func (f *Fake) handleGetFormation(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	app, ok := f.apps[mux.Vars(r)["app"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that app.")
+		return
+	}
+
+	process, ok := app.Formation[mux.Vars(r)["type"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that formation.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, process)
+}
+
+func (f *Fake) handleUpdateFormation(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Updates []struct {
+			Type     string `json:"type"`
+			Quantity *int   `json:"quantity"`
+			Size     string `json:"size"`
+		} `json:"updates"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	app, ok := f.apps[mux.Vars(r)["app"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Couldn't find that app.")
+		return
+	}
+
+	var out []map[string]interface{}
+	for _, u := range body.Updates {
+		process, ok := app.Formation[u.Type]
+		if !ok {
+			process = map[string]interface{}{"type": u.Type, "quantity": 0, "size": "standard-1X"}
+			app.Formation[u.Type] = process
+		}
+		if u.Quantity != nil {
+			process["quantity"] = *u.Quantity
+		}
+		if u.Size != "" {
+			process["size"] = u.Size
+		}
+		out = append(out, process)
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleRelayAuth - mimics the otter relay's login page, the login is authorized right away
+// and the browser sent on to the cli's callback server when there is one
+func (f *Fake) handleRelayAuth(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if session := query.Get("session"); session != "" {
+		scope := query.Get("scope")
+		if scope == "" {
+			scope = "read-protected write-protected"
+		}
+
+		f.mu.Lock()
+		f.sessions[session] = scope
+		f.mu.Unlock()
+	}
+
+	if port := query.Get("port"); port != "" {
+		host := query.Get("host")
+		if host == "" {
+			host = "127.0.0.1"
+		}
+
+		http.Redirect(w, r, "http://"+net.JoinHostPort(host, port)+"/auth/callback", http.StatusFound)
+		return
+	}
+
+	f.handleRelaySuccess(w, r)
+}
+
+// handleRelaySuccess - mimics the otter relay's success page
+func (f *Fake) handleRelaySuccess(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte("<p>You are logged in!</p>"))
+}
+
+// handleRelaySession - mimics the otter relay's headless login polling
+func (f *Fake) handleRelaySession(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["session_secret"] == "" {
+		writeError(w, http.StatusBadRequest, "bad_request", "missing session_secret")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(body["session_secret"]))
+	id := hex.EncodeToString(sum[:])
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	scope, ok := f.sessions[id]
+	if !ok {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "pending"})
+		return
+	}
+
+	delete(f.sessions, id)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  f.accessToken,
+		"refresh_token": f.refreshToken,
+		"expires_in":    28800,
+		"scope":         scope,
+	})
+}
+
+// handleRelayRefresh - mimics the otter relay's /auth/refresh
+func (f *Fake) handleRelayRefresh(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	f.refresh(w, body["refresh_token"])
+}
+
+// handleOauthAuthorize - mimics id.heroku.com/oauth/authorize, the user always grants access
+func (f *Fake) handleOauthAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("client_id") != ClientID || query.Get("response_type") != "code" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "unknown client or response type")
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid redirect_uri")
+		return
+	}
+
+	f.mu.Lock()
+	f.seq++
+	code := fmt.Sprintf("fake-code-%d", f.seq)
+	f.grants[code] = query.Get("code_challenge")
+	f.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// handleOauthToken - mimics id.heroku.com/oauth/token for the authorization code and refresh grants
+func (f *Fake) handleOauthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "refresh_token":
+		f.refresh(w, r.PostForm.Get("refresh_token"))
+	case "authorization_code":
+		f.exchange(w, r.PostForm)
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type")
+	}
+}
+
+// exchange - issue the current tokens for a pending code whose pkce verifier matches
+func (f *Fake) exchange(w http.ResponseWriter, form url.Values) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	challenge, ok := f.grants[form.Get("code")]
+	delete(f.grants, form.Get("code"))
+
+	if !ok || form.Get("client_secret") != ClientSecret {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid code or client.")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(form.Get("code_verifier")))
+	if challenge != "" && challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid code verifier.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  f.accessToken,
+		"refresh_token": f.refreshToken,
+		"expires_in":    28800,
+		"token_type":    "Bearer",
+		"user_id":       "fake-user",
+	})
+}
+
+func (f *Fake) refresh(w http.ResponseWriter, refreshToken string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if refreshToken == "" || refreshToken != f.refreshToken {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid refresh token.")
+		return
+	}
+
+	f.seq++
+	f.accessToken = fmt.Sprintf("%s-%d", AccessToken, f.seq)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  f.accessToken,
+		"refresh_token": f.refreshToken,
+		"expires_in":    28800,
+		"token_type":    "Bearer",
+		"user_id":       "fake-user",
+	})
+}
+
+// release - append a release to the app, callers hold the lock
+func (f *Fake) release(app *App, description string) {
+	f.seq++
+	version := len(app.Releases) + 1
+
+	for _, r := range app.Releases {
+		r["current"] = false
+	}
+
+	app.Releases = append(app.Releases, map[string]interface{}{
+		"id":          fmt.Sprintf("fedcba98-7654-3210-fedc-%012d", f.seq),
+		"version":     version,
+		"description": description,
+		"status":      "succeeded",
+		"current":     true,
+		"user":        map[string]string{"email": Email},
+		"created_at":  stamp(app.CreatedAt.Add(time.Duration(version) * time.Minute)),
+	})
+}
+
+func appJSON(a *App) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         a.ID,
+		"name":       a.Name,
+		"region":     map[string]string{"name": a.Region},
+		"stack":      map[string]string{"name": a.Stack},
+		"owner":      map[string]string{"email": Email},
+		"created_at": stamp(a.CreatedAt),
+		"updated_at": stamp(a.CreatedAt),
+	}
+}
+
+func formationList(a *App) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, p := range a.Formation {
+		out = append(out, p)
+	}
+
+	return out
+}
+
+// writePage - serve one page of items following heroku's Range/Next-Range protocol.
+// Supports "field ..; max=n, order=asc|desc" and the "]last.." form used in Next-Range.
+func writePage(w http.ResponseWriter, r *http.Request, items []map[string]interface{}, field string) {
+	max := defaultPageSize
+	order := "asc"
+	after := ""
+
+	if rng := r.Header.Get("Range"); rng != "" {
+		parts := strings.SplitN(rng, ";", 2)
+		spec := strings.TrimSpace(parts[0])
+
+		if strings.HasPrefix(spec, "]") {
+			after = strings.TrimSuffix(strings.TrimPrefix(spec, "]"), "..")
+		} else if f := strings.TrimSpace(strings.TrimSuffix(spec, "..")); f != "" {
+			field = f
+		}
+
+		if len(parts) == 2 {
+			for _, p := range strings.Split(parts[1], ",") {
+				kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				switch kv[0] {
+				case "max":
+					if n, err := strconv.Atoi(kv[1]); err == nil && n > 0 {
+						max = n
+					}
+				case "order":
+					order = kv[1]
+				case "field":
+					field = kv[1]
+				}
+			}
+		}
+	}
+
+	key := func(item map[string]interface{}) string {
+		v, ok := item[field]
+		if user, isUser := item["user"].(map[string]string); !ok && isUser {
+			v = user[field]
+		}
+		if n, ok := v.(int); ok {
+			return fmt.Sprintf("%020d", n)
+		}
+		if m, ok := v.(map[string]string); ok {
+			return m["email"]
+		}
+		return fmt.Sprintf("%v", v)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if order == "desc" {
+			return key(items[i]) > key(items[j])
+		}
+		return key(items[i]) < key(items[j])
+	})
+
+	start := 0
+	if after != "" {
+		for start < len(items) && key(items[start]) != after {
+			start++
+		}
+		start++
+	}
+	if start > len(items) {
+		start = len(items)
+	}
+
+	end := start + max
+	if end >= len(items) {
+		writeJSON(w, http.StatusOK, nonNil(items[start:]))
+		return
+	}
+
+	w.Header().Set("Next-Range", fmt.Sprintf("]%s..; max=%d, order=%s, field=%s", key(items[end-1]), max, order, field))
+	writeJSON(w, http.StatusPartialContent, items[start:end])
+}
+
+func nonNil(items []map[string]interface{}) []map[string]interface{} {
+	if items == nil {
+		return []map[string]interface{}{}
+	}
+
+	return items
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, id, message string) {
+	writeJSON(w, status, map[string]string{"id": id, "message": message})
+}
+
+func copyVars(vars map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range vars {
+		out[k] = v
+	}
+
+	return out
+}
+
+func stamp(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
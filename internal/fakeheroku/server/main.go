@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Mayowa-Ojo/otter/internal"
+	"github.com/Mayowa-Ojo/otter/internal/fakeheroku"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:5050", "address to listen on")
+	apps := flag.String("apps", "otter-demo,otter-staging", "comma separated apps to seed")
+	login := flag.String("login", "", "throwaway otter config dir to log in to the fake, never your real one")
+	flag.Parse()
+
+	fake := fakeheroku.New()
+
+	for _, name := range strings.Split(*apps, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		fake.AddApp(name)
+		fake.SetConfigVars(name, map[string]string{
+			"PORT":     "5000",
+			"NODE_ENV": "production",
+		})
+	}
+
+	fmt.Println("Starting fake heroku api...http://" + *addr)
+	fmt.Println("Point otter at it with:")
+	fmt.Printf("  export OTTER_API_URL=http://%s OTTER_AUTH_URL=http://%s OTTER_ID_URL=http://%s\n", *addr, *addr, *addr)
+
+	// demo tokens live in a throwaway config dir and file store, so a real login is never replaced
+	if *login != "" {
+		os.Setenv("OTTER_CONFIG_DIR", *login)
+		os.Setenv("OTTER_TOKEN_STORE", internal.STORE_FILE)
+
+		if err := internal.PersistAuthorization(fakeheroku.AccessToken, fakeheroku.RefreshToken); err != nil {
+			log.Fatal("[Error] --login: ", err.Error())
+		}
+
+		fmt.Printf("  export OTTER_CONFIG_DIR=%s OTTER_TOKEN_STORE=%s\n", *login, internal.STORE_FILE)
+	} else {
+		fmt.Printf("  export OTTER_CONFIG_DIR=$(mktemp -d) OTTER_TOKEN_STORE=%s\n", internal.STORE_FILE)
+		fmt.Println("  otter auth")
+	}
+
+	if err := http.ListenAndServe(*addr, fake); err != nil {
+		log.Fatal("[Error] --fake: ", err.Error())
+	}
+}
@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ID_URL - heroku identity server issuing oauth tokens
+const ID_URL string = "https://id.heroku.com"
+
+// OAUTH_SCOPE - scopes requested by otter auth
+const OAUTH_SCOPE string = "read-protected write-protected"
+
+// OAUTH_SCOPES - heroku oauth scopes a login may ask for
+var OAUTH_SCOPES = []string{"global", "identity", "read", "write", "read-protected", "write-protected"}
+
+// writeScopes - scopes allowing changes to apps
+var writeScopes = map[string]bool{"global": true, "write": true, "write-protected": true}
+
+// OAuthClient - heroku oauth client registered by the user, used to log in without the otter relay
+type OAuthClient struct {
+	ID     string `yaml:"client_id,omitempty"`
+	Secret string `yaml:"client_secret,omitempty"`
+}
+
+// IDURL - heroku identity base url, OTTER_ID_URL points otter at another server e.g. a local fake
+func IDURL() string {
+	if uri := os.Getenv("OTTER_ID_URL"); uri != "" {
+		return strings.TrimSuffix(uri, "/")
+	}
+
+	return ID_URL
+}
+
+// LocalOAuthClient - self-hosted oauth client from OTTER_OAUTH_CLIENT_ID/OTTER_OAUTH_CLIENT_SECRET
+// or the oauth section of the settings, nil when none is configured
+func LocalOAuthClient() *OAuthClient {
+	client := &OAuthClient{
+		ID:     os.Getenv("OTTER_OAUTH_CLIENT_ID"),
+		Secret: os.Getenv("OTTER_OAUTH_CLIENT_SECRET"),
+	}
+
+	if client.ID == "" {
+		settings, err := LoadSettings()
+		if err != nil || settings.OAuth == nil || settings.OAuth.ID == "" {
+			return nil
+		}
+
+		client = settings.OAuth
+	}
+
+	return client
+}
+
+// PKCE - proof key for code exchange of a single login
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+// NewPKCE - random code verifier with its S256 challenge
+func NewPKCE() (*PKCE, error) {
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return &PKCE{
+		Verifier:  verifier,
+		Challenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+// NewState - random oauth state binding a callback to the login that started it
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+// NewLoginSession - secret a headless login polls the relay with, and the session id derived
+// from it that goes into the login url
+func NewLoginSession() (secret string, id string, err error) {
+	secret, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+
+	return secret, hex.EncodeToString(sum[:]), nil
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseScopes - validate the scopes asked for with otter auth --scope, the default scopes when none are
+// [values] - scopes, each may hold several separated by commas or spaces
+func ParseScopes(values []string) ([]string, error) {
+	var scopes []string
+	seen := map[string]bool{}
+
+	for _, value := range values {
+		for _, scope := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			valid := false
+			for _, s := range OAUTH_SCOPES {
+				valid = valid || s == scope
+			}
+
+			if !valid {
+				return nil, fmt.Errorf("unknown scope %s - use one of %s", scope, strings.Join(OAUTH_SCOPES, ", "))
+			}
+
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	if len(scopes) == 0 {
+		return strings.Fields(OAUTH_SCOPE), nil
+	}
+
+	return scopes, nil
+}
+
+// AuthorizeURL - identity server page asking the user to grant otter access
+// [redirectURI] - loopback url receiving the authorization code
+// [state] - value the callback must echo back
+// [pkce] - challenge of the login
+// [scopes] - scopes to ask for
+func (c *OAuthClient) AuthorizeURL(redirectURI, state string, pkce *PKCE, scopes []string) string {
+	params := url.Values{}
+	params.Set("client_id", c.ID)
+	params.Set("response_type", "code")
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("code_challenge", pkce.Challenge)
+	params.Set("code_challenge_method", "S256")
+
+	return fmt.Sprintf("%s/oauth/authorize?%s", IDURL(), params.Encode())
+}
+
+// Exchange - trade an authorization code for tokens and save them to the active profile
+// [code] - code received on the callback
+// [redirectURI] - loopback url the code was sent to
+// [pkce] - verifier of the login
+// [scopes] - scopes the login asked for
+func (c *OAuthClient) Exchange(code, redirectURI string, pkce *PKCE, scopes []string) (*TokenPair, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", pkce.Verifier)
+
+	return c.token(form, "", scopes)
+}
+
+// Refresh - get a new access token directly from the identity server
+// [refreshToken] - refresh token issued to this client
+func (c *OAuthClient) Refresh(refreshToken string) (*TokenPair, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+
+	return c.token(form, refreshToken, storedScopes())
+}
+
+// token - call the token endpoint and save the tokens it issues
+// [form] - grant parameters
+// [refreshToken] - kept when the response doesn't rotate the refresh token
+// [scopes] - scopes granted to the tokens, unless the response lists them
+func (c *OAuthClient) token(form url.Values, refreshToken string, scopes []string) (*TokenPair, error) {
+	form.Set("client_id", c.ID)
+	if c.Secret != "" {
+		form.Set("client_secret", c.Secret)
+	}
+
+	req, err := http.NewRequest("POST", IDURL()+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := HTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	byt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(byt, &data); err != nil {
+		return nil, errors.New("authorization failed")
+	}
+
+	if resp.StatusCode != 200 {
+		if msg, ok := data["message"].(string); ok {
+			return nil, errors.New("authorization failed - " + msg)
+		}
+
+		return nil, errors.New("authorization failed")
+	}
+
+	accessToken, ok := data["access_token"].(string)
+	if !ok || accessToken == "" {
+		return nil, errors.New("authorization failed")
+	}
+
+	if rt, ok := data["refresh_token"].(string); ok && rt != "" {
+		refreshToken = rt
+	}
+
+	if scope, ok := data["scope"].(string); ok && scope != "" {
+		scopes = strings.Fields(scope)
+	}
+
+	tokens := &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    ExpiresAt(data["expires_in"]),
+		Scopes:       scopes,
+		ClientID:     c.ID,
+	}
+
+	if err := PersistTokens(tokens); err != nil {
+		return nil, err
+	}
+
+	tokens.Source = SOURCE_LOGIN
+
+	return tokens, nil
+}
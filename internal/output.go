@@ -0,0 +1,360 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+)
+
+// output formats of read commands
+const (
+	OUTPUT_TABLE string = "table"
+	OUTPUT_JSON  string = "json"
+	OUTPUT_YAML  string = "yaml"
+	OUTPUT_CSV   string = "csv"
+	OUTPUT_TSV   string = "tsv"
+)
+
+// OUTPUT_FORMATS - formats accepted by --output
+var OUTPUT_FORMATS = []string{OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_YAML, OUTPUT_CSV, OUTPUT_TSV}
+
+// Field - a value shown by a command. Name is the stable field name of the json/yaml keys and csv
+// headers, scripts rely on it; Header is the table heading meant for humans.
+type Field struct {
+	Name   string
+	Header string
+	// Format - how the value reads in a table, defaults to its plain text
+	Format func(v interface{}) string
+	// Wrap - wrap long values in a table rather than truncating them, e.g. descriptions
+	Wrap bool
+}
+
+// Output - records shown by a read command
+type Output struct {
+	Fields []Field
+	// Records - values of each record in field order, nil values are rendered empty
+	Records [][]interface{}
+	// Single - the command shows one record e.g. an info command, rendered as an object rather than a list
+	Single bool
+	// Empty - table message when there are no records e.g. "No apps yet"
+	Empty string
+	// Style - table style, see TABLE_STYLES
+	Style string
+	// Width - widest a table may get, see TerminalWidth
+	Width int
+}
+
+// CheckOutputFormat - reject an unknown --output value
+// [format] - output format
+func CheckOutputFormat(format string) error {
+	for _, f := range OUTPUT_FORMATS {
+		if f == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown output format %s - use one of %s", format, strings.Join(OUTPUT_FORMATS, ", "))
+}
+
+// Add - append a record
+// [values] - values in field order
+func (o *Output) Add(values ...interface{}) {
+	o.Records = append(o.Records, values)
+}
+
+// Select - keep only some fields, in the order given
+// [names] - field names
+func (o *Output) Select(names []string) error {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = o.fieldIndex(name)
+		if indexes[i] < 0 {
+			return fmt.Errorf("unknown column %s - use one of %s", name, strings.Join(o.fieldNames(), ", "))
+		}
+	}
+
+	fields := make([]Field, len(indexes))
+	for i, index := range indexes {
+		fields[i] = o.Fields[index]
+	}
+
+	for r, values := range o.Records {
+		selected := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			selected[i] = values[index]
+		}
+		o.Records[r] = selected
+	}
+
+	o.Fields = fields
+	return nil
+}
+
+// Sort - order the records by a field, numbers by value and nil first
+// [name] - field name
+// [desc] - largest first
+func (o *Output) Sort(name string, desc bool) error {
+	index := o.fieldIndex(name)
+	if index < 0 {
+		return fmt.Errorf("unknown sort column %s - use one of %s", name, strings.Join(o.fieldNames(), ", "))
+	}
+
+	sort.SliceStable(o.Records, func(i, j int) bool {
+		if desc {
+			return compareValues(o.Records[j][index], o.Records[i][index]) < 0
+		}
+		return compareValues(o.Records[i][index], o.Records[j][index]) < 0
+	})
+
+	return nil
+}
+
+func (o *Output) fieldIndex(name string) int {
+	for i, f := range o.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (o *Output) fieldNames() []string {
+	names := make([]string, len(o.Fields))
+	for i, f := range o.Fields {
+		names[i] = f.Name
+	}
+
+	return names
+}
+
+// compareValues - -1, 0 or 1 as a sorts before, with or after b
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok && x != y {
+			if y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// number - numeric value of ints and floats
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// Render - write the records in a format
+// [w] - where the output goes, usually stdout
+// [format] - one of OUTPUT_FORMATS
+func (o *Output) Render(w io.Writer, format string) error {
+	switch format {
+	case OUTPUT_JSON:
+		return o.renderJSON(w)
+	case OUTPUT_YAML:
+		return o.renderYAML(w)
+	case OUTPUT_CSV:
+		return o.renderCSV(w, ',')
+	case OUTPUT_TSV:
+		return o.renderCSV(w, '\t')
+	case OUTPUT_TABLE, "":
+		return o.renderTable(w)
+	}
+
+	return CheckOutputFormat(format)
+}
+
+// orderedRecord - json object keeping the field order
+type orderedRecord struct {
+	fields []Field
+	values []interface{}
+}
+
+// MarshalJSON - encode the record with its keys in field order
+func (r orderedRecord) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, f := range r.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (o *Output) renderJSON(w io.Writer) error {
+	records := []orderedRecord{}
+	for _, values := range o.Records {
+		records = append(records, orderedRecord{fields: o.Fields, values: values})
+	}
+
+	var v interface{} = records
+	if o.Single && len(records) == 1 {
+		v = records[0]
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func (o *Output) renderYAML(w io.Writer) error {
+	records := []yaml.MapSlice{}
+	for _, values := range o.Records {
+		record := yaml.MapSlice{}
+		for i, f := range o.Fields {
+			record = append(record, yaml.MapItem{Key: f.Name, Value: values[i]})
+		}
+		records = append(records, record)
+	}
+
+	var v interface{} = records
+	if o.Single && len(records) == 1 {
+		v = records[0]
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// renderCSV - header of field names, then a row per record
+// [comma] - field delimiter
+func (o *Output) renderCSV(w io.Writer, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+
+	header := make([]string, len(o.Fields))
+	for i, f := range o.Fields {
+		header[i] = f.Name
+	}
+
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, values := range o.Records {
+		if err := cw.Write(o.strings(values)); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// renderTable - a table of the records, or "Header: value" lines for a single record
+func (o *Output) renderTable(w io.Writer) error {
+	if o.Single && len(o.Records) == 1 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for i, value := range o.tableStrings(o.Records[0]) {
+			fmt.Fprintf(tw, "%s:\t%s\n", o.Fields[i].Header, value)
+		}
+
+		return tw.Flush()
+	}
+
+	table := &Table{Style: o.Style, Width: o.Width, Empty: o.Empty}
+	for _, f := range o.Fields {
+		table.Columns = append(table.Columns, Column{Header: f.Header, Wrap: f.Wrap})
+	}
+
+	for _, values := range o.Records {
+		table.Rows = append(table.Rows, o.tableStrings(values))
+	}
+
+	return table.Render(w)
+}
+
+// tableStrings - values as they read in a table
+func (o *Output) tableStrings(values []interface{}) []string {
+	out := o.strings(values)
+	for i, f := range o.Fields {
+		if f.Format != nil {
+			out[i] = f.Format(values[i])
+		}
+	}
+
+	return out
+}
+
+// strings - values as text, nil as empty
+func (o *Output) strings(values []interface{}) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		switch val := v.(type) {
+		case nil:
+		case []string:
+			out[i] = strings.Join(val, " ")
+		default:
+			out[i] = fmt.Sprint(val)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// DEFAULT_PROFILE - profile used when none is selected, its tokens live in ~/.config/otter/.keys
+const DEFAULT_PROFILE string = "default"
+
+// KEYS_FILE - plaintext token file inside a profile directory, migrated to the token store
+const KEYS_FILE string = "/.keys"
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var activeProfile = DEFAULT_PROFILE
+
+// SetProfile - select the profile whose tokens and defaults are used
+// [name] - profile name, letters, digits, '-' and '_' only
+func SetProfile(name string) error {
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q - use letters, digits, '-' and '_'", name)
+	}
+
+	activeProfile = name
+
+	return nil
+}
+
+// ActiveProfile - name of the selected profile
+func ActiveProfile() string {
+	return activeProfile
+}
+
+// ProfileDir - directory that held a profile's plaintext tokens
+// [name] - profile name
+func ProfileDir(name string) (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	// the default profile keeps the original location so existing logins carry over
+	if name == DEFAULT_PROFILE {
+		return configDir, nil
+	}
+
+	return filepath.Join(configDir, "profiles", name), nil
+}
+
+// ListProfiles - every profile with stored tokens or saved defaults
+func ListProfiles() ([]string, error) {
+	seen := map[string]bool{}
+
+	store, err := CurrentTokenStore()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range stored {
+		seen[name] = true
+	}
+
+	settings, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range settings.Profiles {
+		seen[name] = true
+	}
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"os"
+	"time"
+
+	"github.com/theckman/yacspin"
+)
+
+// ProgressSettings - how commands report progress
+type ProgressSettings struct {
+	// Quiet - no spinners or notes, only the command's output and errors
+	Quiet bool
+	// NoColor - plain text only e.g. NO_COLOR or --no-color
+	NoColor bool
+}
+
+var progress ProgressSettings
+
+// progressOut - where spinners are drawn, stdout is kept for the command's output
+var progressOut = os.Stderr
+
+// SetProgress - configure progress reporting, usually from --quiet and --no-color
+// [settings] - progress settings
+func SetProgress(settings ProgressSettings) {
+	progress = settings
+}
+
+// Quiet - whether notes on stderr should be left out
+func Quiet() bool {
+	return progress.Quiet
+}
+
+// IsTerminal - whether a file is a terminal rather than e.g. a pipe, a file or a ci log
+// [f] - usually os.Stdout or os.Stderr
+func IsTerminal(f *os.File) bool {
+	_, ok := terminalWidth(f.Fd())
+	return ok
+}
+
+// Spinner - loading spinner on stderr. It does nothing when stderr isn't a terminal or --quiet is set,
+// and every method is safe to call on a stopped, disabled or nil spinner
+type Spinner struct {
+	spinner *yacspin.Spinner
+	running bool
+}
+
+// LoadingSpinner - spinner for a command's api calls, drawn once started
+func LoadingSpinner() *Spinner {
+	if progress.Quiet || !IsTerminal(progressOut) {
+		return &Spinner{}
+	}
+
+	config := yacspin.Config{
+		Frequency:         100 * time.Millisecond,
+		CharSet:           yacspin.CharSets[69],
+		Prefix:            "Please wait... ",
+		Message:           "",
+		StopCharacter:     "✓",
+		StopFailMessage:   "",
+		StopFailCharacter: "✗",
+		Writer:            progressOut,
+	}
+
+	if !progress.NoColor {
+		config.StopFailColors = []string{"fgRed"}
+		config.StopColors = []string{"fgGreen"}
+	}
+
+	spinner, err := yacspin.New(config)
+	if err != nil {
+		// a spinner is never worth failing a command
+		return &Spinner{}
+	}
+
+	return &Spinner{spinner: spinner}
+}
+
+// Start - start drawing the spinner
+func (s *Spinner) Start() {
+	if s == nil || s.spinner == nil || s.running {
+		return
+	}
+
+	s.running = s.spinner.Start() == nil
+}
+
+// Prefix - text shown before the spinner
+// [prefix] - e.g. "Waiting for authorization..."
+func (s *Spinner) Prefix(prefix string) {
+	if s == nil || s.spinner == nil {
+		return
+	}
+
+	s.spinner.Prefix(prefix)
+}
+
+// Stop - stop the spinner with a success mark
+func (s *Spinner) Stop() {
+	if s == nil || s.spinner == nil || !s.running {
+		return
+	}
+
+	s.spinner.Stop()
+	s.running = false
+}
+
+// StopFail - stop the spinner with a failure mark, nothing happens once it is stopped
+// so it can be deferred to cover every error path
+func (s *Spinner) StopFail() {
+	if s == nil || s.spinner == nil || !s.running {
+		return
+	}
+
+	s.spinner.StopFail()
+	s.running = false
+}
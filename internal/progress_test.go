@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadingSpinner(t *testing.T) {
+	defer func(out *os.File, settings ProgressSettings) { progressOut, progress = out, settings }(progressOut, progress)
+
+	f, err := ioutil.TempFile("", "otter-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	t.Log("Should not draw spinners outside a terminal or when quiet")
+	{
+		progressOut = f
+
+		for _, settings := range []ProgressSettings{{}, {Quiet: true}} {
+			SetProgress(settings)
+
+			spinner := LoadingSpinner()
+			spinner.Start()
+			spinner.Prefix("Done.")
+			spinner.Stop()
+			spinner.StopFail()
+
+			if spinner.spinner != nil {
+				t.Fatalf("\t%s\tShould disable the spinner: %+v", failed, settings)
+			}
+		}
+
+		if info, err := f.Stat(); err != nil || info.Size() != 0 {
+			t.Fatalf("\t%s\tShould not write to a file: %v %v", failed, info, err)
+		}
+
+		t.Logf("\t%s\tShould not draw spinners outside a terminal or when quiet", succeed)
+	}
+
+	t.Log("Should be safe to use a nil spinner")
+	{
+		var spinner *Spinner
+		spinner.Start()
+		spinner.Prefix("something went wrong...")
+		spinner.StopFail()
+		spinner.Stop()
+
+		t.Logf("\t%s\tShould be safe to use a nil spinner", succeed)
+	}
+}
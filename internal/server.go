@@ -2,13 +2,22 @@ package internal
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// CALLBACK_ADDRESS - loopback address of the login callback server, port 0 picks a free port
+const CALLBACK_ADDRESS string = "127.0.0.1:0"
+
+// LOCAL_CALLBACK_ADDRESS - callback address of self-hosted oauth clients, whose registered
+// callback url needs a fixed port
+const LOCAL_CALLBACK_ADDRESS string = "127.0.0.1:7070"
+
 // HTTPHandler -
 type HTTPHandler struct {
 	Handler func(http.ResponseWriter, *http.Request)
@@ -16,42 +25,103 @@ type HTTPHandler struct {
 	Path    string
 }
 
-// EphemeralServer - create a short-lived server to listen for requests
-func EphemeralServer(shutdownChan chan string, handlers []HTTPHandler) {
-	r := mux.NewRouter()
+// EphemeralServer - short-lived server listening for requests e.g. the login callback
+type EphemeralServer struct {
+	srv      *http.Server
+	listener net.Listener
+	// host - host of the url the browser is sent to
+	host string
+}
+
+// CallbackAddress - bind address of the login callback server from OTTER_CALLBACK_ADDRESS
+// or the callback_address setting
+// [local] - the login uses a self-hosted oauth client
+func CallbackAddress(local bool) string {
+	if addr := os.Getenv("OTTER_CALLBACK_ADDRESS"); addr != "" {
+		return addr
+	}
+
+	if settings, err := LoadSettings(); err == nil && settings.CallbackAddress != "" {
+		return settings.CallbackAddress
+	}
+
+	if local {
+		return LOCAL_CALLBACK_ADDRESS
+	}
+
+	return CALLBACK_ADDRESS
+}
+
+// LoopbackAddress - validate a callback address: the browser has to reach it on this machine, so
+// only loopback hosts are accepted and an unspecified host e.g. :7070 or 0.0.0.0:7070 means 127.0.0.1
+// [addr] - host:port of the callback server
+func LoopbackAddress(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid callback address %s - use host:port e.g. %s", addr, LOCAL_CALLBACK_ADDRESS)
+	}
 
-	srv := &http.Server{
-		Addr:         "127.0.0.1:7070",
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		Handler:      r,
+	ip := net.ParseIP(host)
+	switch {
+	case host == "" || (ip != nil && ip.IsUnspecified()):
+		host = "127.0.0.1"
+	case host == "localhost" || (ip != nil && ip.IsLoopback()):
+	default:
+		return "", fmt.Errorf("callback address %s isn't a loopback address - the browser is sent back to this machine, use e.g. 127.0.0.1:%s", addr, port)
 	}
 
+	return net.JoinHostPort(host, port), nil
+}
+
+// NewEphemeralServer - start serving the handlers, the server runs until Shutdown
+// [addr] - loopback bind address, port 0 picks a free port
+// [handlers] - routes of the server
+func NewEphemeralServer(addr string, handlers []HTTPHandler) (*EphemeralServer, error) {
+	addr, err := LoopbackAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := mux.NewRouter()
+
 	for _, h := range handlers {
 		r.HandleFunc(h.Path, h.Handler).Methods(h.Method)
 	}
 
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-		w.Write([]byte("up and running..."))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start the callback server on %s - %s", addr, err.Error())
+	}
+
+	// a registered callback url must match to the host, so localhost stays localhost
+	host, _, _ := net.SplitHostPort(addr)
+
+	s := &EphemeralServer{
+		host:     host,
+		listener: listener,
+		srv: &http.Server{
+			WriteTimeout: time.Second * 15,
+			ReadTimeout:  time.Second * 15,
+			Handler:      r,
+		},
+	}
 
-		shutdownChan <- "done"
-	}).Methods("POST")
+	go s.srv.Serve(listener)
 
-	go func(s *http.Server) {
-		err := srv.ListenAndServe()
-		if err != nil {
-			log.Fatal("[Error] --web: ", err.Error())
-		}
-	}(srv)
+	return s, nil
+}
 
-	msg := <-shutdownChan
+// URL - base url the server is reachable at, with the port actually bound
+func (s *EphemeralServer) URL() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
 
+	return "http://" + net.JoinHostPort(s.host, port)
+}
+
+// Shutdown - stop the server, waiting up to 15s for requests in flight
+func (s *EphemeralServer) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
-	if msg != "done" {
-		log.Fatal("[Error]: something went wrong")
-		srv.Shutdown(ctx)
-	}
+	return s.srv.Shutdown(ctx)
 }
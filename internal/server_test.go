@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoopbackAddress(t *testing.T) {
+	t.Log("Should listen on loopback when the host is unspecified")
+	{
+		cases := map[string]string{
+			":7070":          "127.0.0.1:7070",
+			"0.0.0.0:7070":   "127.0.0.1:7070",
+			"[::]:0":         "127.0.0.1:0",
+			"127.0.0.1:0":    "127.0.0.1:0",
+			"localhost:7070": "localhost:7070",
+			"[::1]:7070":     "[::1]:7070",
+		}
+
+		for addr, want := range cases {
+			if got, err := LoopbackAddress(addr); err != nil || got != want {
+				t.Fatalf("\t%s\tShould use %s for %s: %s %v", failed, want, addr, got, err)
+			}
+		}
+
+		t.Logf("\t%s\tShould listen on loopback when the host is unspecified", succeed)
+	}
+
+	t.Log("Should reject callback addresses the browser can't reach on this machine")
+	{
+		for _, addr := range []string{"192.168.1.10:7070", "example.com:7070", "7070"} {
+			if _, err := LoopbackAddress(addr); err == nil {
+				t.Fatalf("\t%s\tShould reject %s", failed, addr)
+			}
+		}
+
+		if _, err := NewEphemeralServer("10.0.0.1:7070", nil); err == nil || !strings.Contains(err.Error(), "isn't a loopback address") {
+			t.Fatalf("\t%s\tShould not start a callback server off loopback: %v", failed, err)
+		}
+
+		t.Logf("\t%s\tShould reject callback addresses the browser can't reach on this machine", succeed)
+	}
+
+	t.Log("Should report a url the browser can use")
+	{
+		srv, err := NewEphemeralServer(":0", nil)
+		if err != nil {
+			t.Fatalf("\t%s\tShould start the server: %v", failed, err)
+		}
+		defer srv.Shutdown()
+
+		if !strings.HasPrefix(srv.URL(), "http://127.0.0.1:") || strings.HasSuffix(srv.URL(), ":0") {
+			t.Fatalf("\t%s\tShould report the loopback url: %s", failed, srv.URL())
+		}
+
+		t.Logf("\t%s\tShould report a url the browser can use", succeed)
+	}
+}
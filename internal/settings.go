@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+
+	yaml "github.com/goccy/go-yaml"
+)
+
+// SETTINGS_FILE - user settings file inside the config directory
+const SETTINGS_FILE string = "/config.yaml"
+
+// Settings - user preferences read from ~/.config/otter/config.yaml
+type Settings struct {
+	// CAFile - pem bundle trusted in addition to the system roots
+	CAFile string `yaml:"ca_file,omitempty"`
+	// Timeout - per request timeout e.g. 30s
+	Timeout string `yaml:"timeout,omitempty"`
+	// Credentials - "env-first" prefers OTTER_TOKEN, HEROKU_API_KEY and ~/.netrc over the otter login
+	Credentials string `yaml:"credentials,omitempty"`
+	// TokenStore - backend keeping tokens, "secret-service" or "file", picked automatically when empty
+	TokenStore string `yaml:"token_store,omitempty"`
+	// OAuth - self-hosted oauth client, otter auth talks to heroku directly instead of the relay when set
+	OAuth *OAuthClient `yaml:"oauth,omitempty"`
+	// CallbackAddress - bind address of the login callback server, a free loopback port when empty
+	CallbackAddress string `yaml:"callback_address,omitempty"`
+	// Profile - profile selected with otter auth use
+	Profile string `yaml:"profile,omitempty"`
+	// Profiles - per profile defaults
+	Profiles map[string]*ProfileSettings `yaml:"profiles,omitempty"`
+}
+
+// ProfileSettings - defaults applied while a profile is active
+type ProfileSettings struct {
+	// App - app used when --app is omitted
+	App string `yaml:"app,omitempty"`
+}
+
+// ProfileDefaults - defaults of the active profile, never nil
+func (s *Settings) ProfileDefaults() *ProfileSettings {
+	if p, ok := s.Profiles[activeProfile]; ok && p != nil {
+		return p
+	}
+
+	return &ProfileSettings{}
+}
+
+// LoadSettings - read user settings, a missing file yields empty settings
+func LoadSettings() (*Settings, error) {
+	var settings Settings
+
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	byt, err := ioutil.ReadFile(configDir + SETTINGS_FILE)
+	if os.IsNotExist(err) {
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(byt, &settings); err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// SaveSettings - write user settings to the config directory
+func SaveSettings(settings *Settings) error {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return err
+	}
+
+	byt, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	return writePrivateFile(configDir+SETTINGS_FILE, byt)
+}
@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// table styles
+const (
+	STYLE_MARKDOWN   string = "markdown"
+	STYLE_COMPACT    string = "compact"
+	STYLE_BORDERLESS string = "borderless"
+)
+
+// TABLE_STYLES - styles accepted by --style
+var TABLE_STYLES = []string{STYLE_MARKDOWN, STYLE_COMPACT, STYLE_BORDERLESS}
+
+// minColumnWidth - narrowest a column is shrunk to when the table doesn't fit the terminal
+const minColumnWidth = 8
+
+// Column - a table column
+type Column struct {
+	Header string
+	// Wrap - wrap long cells over several lines rather than truncating them with …
+	Wrap bool
+}
+
+// Table - rows of text in columns, fitted to the terminal
+type Table struct {
+	Columns []Column
+	Rows    [][]string
+	// Style - one of TABLE_STYLES, defaults to markdown
+	Style string
+	// Width - widest the table may get, usually the terminal's width; 0 doesn't limit it
+	Width int
+	// Empty - shown instead of the table when there are no rows, defaults to "No results"
+	Empty string
+}
+
+// CheckTableStyle - reject an unknown --style value
+// [style] - table style
+func CheckTableStyle(style string) error {
+	for _, s := range TABLE_STYLES {
+		if s == style {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown table style %s - use one of %s", style, strings.Join(TABLE_STYLES, ", "))
+}
+
+// Render - write the table
+// [w] - where the table goes, usually stdout
+func (t *Table) Render(w io.Writer) error {
+	if len(t.Rows) == 0 {
+		empty := t.Empty
+		if empty == "" {
+			empty = "No results"
+		}
+
+		_, err := fmt.Fprintln(w, empty)
+		return err
+	}
+
+	style := t.Style
+	if style == "" {
+		style = STYLE_MARKDOWN
+	}
+	if err := CheckTableStyle(style); err != nil {
+		return err
+	}
+
+	widths := t.fit(style)
+
+	headers := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		headers[i] = c.Header
+	}
+
+	var b strings.Builder
+
+	t.writeRow(&b, style, widths, headers)
+	switch style {
+	case STYLE_MARKDOWN:
+		b.WriteString("|")
+		for _, width := range widths {
+			b.WriteString(strings.Repeat("-", width+2) + "|")
+		}
+		b.WriteString("\n")
+	case STYLE_COMPACT:
+		dashes := make([]string, len(widths))
+		for i, width := range widths {
+			dashes[i] = strings.Repeat("-", width)
+		}
+		t.writeLine(&b, style, widths, dashes)
+	}
+
+	for _, row := range t.Rows {
+		t.writeRow(&b, style, widths, row)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// String - the table as text
+func (t *Table) String() string {
+	var b strings.Builder
+	t.Render(&b)
+
+	return b.String()
+}
+
+// fit - width of each column, the widest ones shrunk until the table fits t.Width
+// [style] - table style, decides the room taken by separators
+func (t *Table) fit(style string) []int {
+	widths := make([]int, len(t.Columns))
+	for i, c := range t.Columns {
+		widths[i] = textWidth(c.Header)
+	}
+
+	for _, row := range t.Rows {
+		for i := range widths {
+			if i < len(row) && textWidth(row[i]) > widths[i] {
+				widths[i] = textWidth(row[i])
+			}
+		}
+	}
+
+	if t.Width <= 0 {
+		return widths
+	}
+
+	// separators - "| " ... " | " ... " |" in markdown, two spaces between columns otherwise
+	room := t.Width - 2*(len(widths)-1)
+	if style == STYLE_MARKDOWN {
+		room = t.Width - 3*len(widths) - 1
+	}
+
+	for sum(widths) > room {
+		widest := -1
+		for i, width := range widths {
+			if width > minColumnWidth && (widest < 0 || width > widths[widest]) {
+				widest = i
+			}
+		}
+
+		// every column is as narrow as it gets, let the terminal wrap the rest
+		if widest < 0 {
+			break
+		}
+
+		widths[widest]--
+	}
+
+	return widths
+}
+
+// writeRow - write a row, its cells wrapped or truncated to the column widths
+func (t *Table) writeRow(b *strings.Builder, style string, widths []int, row []string) {
+	cells := make([][]string, len(widths))
+	height := 1
+
+	for i, width := range widths {
+		var text string
+		if i < len(row) {
+			text = row[i]
+		}
+
+		if t.Columns[i].Wrap {
+			cells[i] = wrapText(text, width)
+		} else {
+			cells[i] = []string{truncateText(strings.Join(strings.Split(text, "\n"), " "), width)}
+		}
+
+		if len(cells[i]) > height {
+			height = len(cells[i])
+		}
+	}
+
+	for line := 0; line < height; line++ {
+		texts := make([]string, len(widths))
+		for i := range widths {
+			if line < len(cells[i]) {
+				texts[i] = cells[i][line]
+			}
+		}
+
+		t.writeLine(b, style, widths, texts)
+	}
+}
+
+// writeLine - write one line of cells padded to the column widths
+func (t *Table) writeLine(b *strings.Builder, style string, widths []int, texts []string) {
+	cells := make([]string, len(widths))
+	for i, width := range widths {
+		cells[i] = runewidth.FillRight(texts[i], width)
+	}
+
+	if style == STYLE_MARKDOWN {
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		return
+	}
+
+	b.WriteString(strings.TrimRight(strings.Join(cells, "  "), " ") + "\n")
+}
+
+// textWidth - columns taken by the widest line of a text
+func textWidth(text string) int {
+	widest := 0
+	for _, line := range strings.Split(text, "\n") {
+		if w := runewidth.StringWidth(line); w > widest {
+			widest = w
+		}
+	}
+
+	return widest
+}
+
+// truncateText - cut a text to a width, marking the cut with …
+func truncateText(text string, width int) string {
+	return runewidth.Truncate(text, width, "…")
+}
+
+// wrapText - break a text into lines of at most width columns, at spaces where possible
+func wrapText(text string, width int) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			// words longer than a line are broken up
+			for runewidth.StringWidth(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+
+				head := runewidth.Truncate(word, width, "")
+				if head == "" {
+					// a wide character in a narrower column
+					head = string([]rune(word)[:1])
+				}
+
+				lines = append(lines, head)
+				word = word[len(head):]
+			}
+
+			switch {
+			case line == "":
+				line = word
+			case runewidth.StringWidth(line)+1+runewidth.StringWidth(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+
+	return total
+}
@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"os"
+	"strconv"
+)
+
+// TerminalWidth - columns of the terminal a file writes to, 0 when it isn't a terminal e.g. a pipe,
+// COLUMNS takes precedence over the terminal's own size
+// [f] - usually os.Stdout
+func TerminalWidth(f *os.File) int {
+	width, ok := terminalWidth(f.Fd())
+	if !ok {
+		return 0
+	}
+
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	return width
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package internal
+
+import "golang.org/x/sys/unix"
+
+// terminalWidth - columns of the terminal behind a file descriptor, false when it isn't one
+func terminalWidth(fd uintptr) (int, bool) {
+	ws, err := unix.IoctlGetWinsize(int(fd), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, false
+	}
+
+	return int(ws.Col), true
+}
@@ -0,0 +1,13 @@
+package internal
+
+import "golang.org/x/sys/windows"
+
+// terminalWidth - columns of the console window behind a handle, false when it isn't a console
+func terminalWidth(fd uintptr) (int, bool) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return 0, false
+	}
+
+	return int(info.Window.Right-info.Window.Left) + 1, true
+}
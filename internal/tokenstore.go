@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNoTokens - the store holds no tokens for the profile
+var ErrNoTokens = errors.New("no auth token found")
+
+// TokenStore - keeps the tokens of each profile
+type TokenStore interface {
+	// Name - backend name as used in settings and OTTER_TOKEN_STORE
+	Name() string
+	// Load - tokens of a profile, ErrNoTokens when there are none
+	Load(profile string) (*TokenPair, error)
+	// Save - replace the tokens of a profile
+	Save(profile string, tokens *TokenPair) error
+	// Delete - remove the tokens of a profile, a missing profile is not an error
+	Delete(profile string) error
+	// List - profiles with stored tokens
+	List() ([]string, error)
+}
+
+// tokenStores - available backends by name, platform specific backends register themselves
+var tokenStores = map[string]func() (TokenStore, error){
+	STORE_FILE: newFileStore,
+}
+
+// tokenStorePreference - backends tried in order when none is configured
+var tokenStorePreference = []string{STORE_SECRET_SERVICE, STORE_FILE}
+
+// token store backends
+const (
+	STORE_FILE           string = "file"
+	STORE_SECRET_SERVICE string = "secret-service"
+)
+
+var tokenStore struct {
+	once  sync.Once
+	store TokenStore
+	err   error
+}
+
+// RegisterTokenStore - make a backend selectable by name
+// [name] - backend name
+// [factory] - opens the backend, an error makes auto selection move on to the next one
+func RegisterTokenStore(name string, factory func() (TokenStore, error)) {
+	tokenStores[name] = factory
+}
+
+// CurrentTokenStore - backend selected through OTTER_TOKEN_STORE, the token_store setting
+// or the first available one. Tokens from the old plaintext .keys files are migrated on first use.
+func CurrentTokenStore() (TokenStore, error) {
+	tokenStore.once.Do(func() {
+		tokenStore.store, tokenStore.err = openTokenStore()
+		if tokenStore.err == nil {
+			tokenStore.err = migrateLegacyKeys(tokenStore.store)
+		}
+	})
+
+	return tokenStore.store, tokenStore.err
+}
+
+func openTokenStore() (TokenStore, error) {
+	name := os.Getenv("OTTER_TOKEN_STORE")
+	if name == "" {
+		if settings, err := LoadSettings(); err == nil {
+			name = settings.TokenStore
+		}
+	}
+
+	if name != "" {
+		factory, ok := tokenStores[name]
+		if !ok {
+			var names []string
+			for n := range tokenStores {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+
+			return nil, fmt.Errorf("unknown token store %q - available: %s", name, strings.Join(names, ", "))
+		}
+
+		return factory()
+	}
+
+	var lastErr error
+	for _, name := range tokenStorePreference {
+		factory, ok := tokenStores[name]
+		if !ok {
+			continue
+		}
+
+		store, err := factory()
+		if err == nil {
+			return store, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// legacyKeysPath - plaintext token file used before token stores
+// [profile] - profile name
+func legacyKeysPath(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+	if err != nil {
+		return "", err
+	}
+
+	return dir + KEYS_FILE, nil
+}
+
+// migrateLegacyKeys - move tokens from plaintext .keys files into the store and delete the files
+func migrateLegacyKeys(store TokenStore) error {
+	profiles := []string{DEFAULT_PROFILE}
+
+	configDir, err := ConfigDir()
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(configDir, "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() && profileName.MatchString(e.Name()) {
+			profiles = append(profiles, e.Name())
+		}
+	}
+
+	for _, profile := range profiles {
+		path, err := legacyKeysPath(profile)
+		if err != nil {
+			return err
+		}
+
+		byt, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if tokens, err := parseLegacyKeys(string(byt)); err == nil {
+			if err := store.Save(profile, tokens); err != nil {
+				return fmt.Errorf("couldn't migrate tokens of profile %s: %s", profile, err.Error())
+			}
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+
+		if profile != DEFAULT_PROFILE {
+			// only succeeds when nothing else lives in the profile directory
+			os.Remove(filepath.Dir(path))
+		}
+	}
+
+	return nil
+}
+
+// parseLegacyKeys - read the access_token=...\nrefresh_token=... format
+func parseLegacyKeys(content string) (*TokenPair, error) {
+	lines := strings.Split(content, "\n")
+
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "access_token=") {
+		return nil, ErrNoTokens
+	}
+
+	if !strings.HasPrefix(lines[1], "refresh_token=") {
+		return nil, ErrNoTokens
+	}
+
+	return &TokenPair{
+		AccessToken:  strings.TrimPrefix(lines[0], "access_token="),
+		RefreshToken: strings.TrimPrefix(lines[1], "refresh_token="),
+	}, nil
+}
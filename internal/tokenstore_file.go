@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// CREDENTIALS_FILE - encrypted tokens of every profile
+	CREDENTIALS_FILE string = "/credentials"
+	// CREDENTIALS_KEY_FILE - key the credentials file is encrypted with
+	CREDENTIALS_KEY_FILE string = "/.credentials.key"
+
+	credentialsHeader = "otter-aes-gcm-v1:"
+)
+
+// fileStore - tokens encrypted with AES-GCM in the config directory.
+// The key lives in its own 0600 file, which keeps tokens out of backups, dotfile repos and
+// screen shares of the credentials file, but can't protect against other code running as the user -
+// prefer the secret service where one is available.
+type fileStore struct {
+	dir string
+}
+
+func newFileStore() (TokenStore, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStore{dir: dir}, nil
+}
+
+// Name - backend name
+func (s *fileStore) Name() string {
+	return STORE_FILE
+}
+
+// Load - tokens of a profile
+func (s *fileStore) Load(profile string) (*TokenPair, error) {
+	all, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, ok := all[profile]
+	if !ok || tokens.AccessToken == "" {
+		return nil, ErrNoTokens
+	}
+
+	return tokens, nil
+}
+
+// Save - replace the tokens of a profile
+func (s *fileStore) Save(profile string, tokens *TokenPair) error {
+	all, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	all[profile] = tokens
+
+	return s.write(all)
+}
+
+// Delete - remove the tokens of a profile
+func (s *fileStore) Delete(profile string) error {
+	all, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := all[profile]; !ok {
+		return nil
+	}
+
+	delete(all, profile)
+
+	return s.write(all)
+}
+
+// List - profiles with stored tokens
+func (s *fileStore) List() ([]string, error) {
+	all, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *fileStore) read() (map[string]*TokenPair, error) {
+	all := map[string]*TokenPair{}
+
+	byt, err := ioutil.ReadFile(s.dir + CREDENTIALS_FILE)
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.key(false)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := decrypt(key, strings.TrimSpace(string(byt)))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(plain, &all); err != nil {
+		return nil, err
+	}
+
+	return all, nil
+}
+
+func (s *fileStore) write(all map[string]*TokenPair) error {
+	if err := ensurePrivateDir(s.dir); err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.key(true)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := encrypt(key, plain)
+	if err != nil {
+		return err
+	}
+
+	return writePrivateFile(s.dir+CREDENTIALS_FILE, []byte(sealed))
+}
+
+// key - read the encryption key, creating one when allowed
+func (s *fileStore) key(create bool) ([]byte, error) {
+	path := s.dir + CREDENTIALS_KEY_FILE
+
+	byt, err := ioutil.ReadFile(path)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(byt)))
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("credentials key is corrupt - remove " + s.dir + CREDENTIALS_FILE + " and log in again")
+		}
+
+		return key, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if !create {
+		return nil, errors.New("credentials key is missing - remove " + s.dir + CREDENTIALS_FILE + " and log in again")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if err := writePrivateFile(path, []byte(base64.StdEncoding.EncodeToString(key))); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func encrypt(key, plain []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+
+	return credentialsHeader + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decrypt(key []byte, content string) ([]byte, error) {
+	if !strings.HasPrefix(content, credentialsHeader) {
+		return nil, errors.New("unrecognized credentials file format")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(content, credentialsHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("credentials file is corrupt")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("couldn't decrypt credentials file - remove it and log in again")
+	}
+
+	return plain, nil
+}
+
+// ensurePrivateDir - create a directory only the user can access, tightening an existing one
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, DIR_PERMISSION); err != nil {
+		return err
+	}
+
+	return os.Chmod(dir, DIR_PERMISSION)
+}
+
+// writePrivateFile - atomically replace a file readable only by the user
+func writePrivateFile(path string, data []byte) error {
+	if err := ensurePrivateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(FILE_PERMISSION); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	secretsBusName        = "org.freedesktop.secrets"
+	secretsPath           = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretsCollection     = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	secretsServiceIface   = "org.freedesktop.Secret.Service"
+	secretsCollectionIfc  = "org.freedesktop.Secret.Collection"
+	secretsItemIface      = "org.freedesktop.Secret.Item"
+	secretsPromptIface    = "org.freedesktop.Secret.Prompt"
+	secretsNoPrompt       = dbus.ObjectPath("/")
+	secretsPromptTimeout  = 2 * time.Minute
+	secretsAttributeApp   = "application"
+	secretsAttributeValue = "otter"
+)
+
+// secretValue - org.freedesktop.Secret.Secret struct (oayays)
+type secretValue struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// secretServiceStore - tokens kept by the freedesktop secret service (gnome-keyring, kwallet, keepassxc)
+// over the session d-bus, one item per profile
+type secretServiceStore struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+func init() {
+	RegisterTokenStore(STORE_SECRET_SERVICE, newSecretServiceStore)
+}
+
+func newSecretServiceStore() (TokenStore, error) {
+	// don't let the dbus library try to autolaunch a bus on headless machines
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, errors.New("secret service unavailable - no d-bus session")
+	}
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+
+	var output dbus.Variant
+	var session dbus.ObjectPath
+
+	service := conn.Object(secretsBusName, secretsPath)
+	if err := service.Call(secretsServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &secretServiceStore{conn: conn, session: session}, nil
+}
+
+// Name - backend name
+func (s *secretServiceStore) Name() string {
+	return STORE_SECRET_SERVICE
+}
+
+// Load - tokens of a profile
+func (s *secretServiceStore) Load(profile string) (*TokenPair, error) {
+	items, err := s.search(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, ErrNoTokens
+	}
+
+	if err := s.unlock(items[:1]); err != nil {
+		return nil, err
+	}
+
+	var secret secretValue
+	if err := s.conn.Object(secretsBusName, items[0]).Call(secretsItemIface+".GetSecret", 0, s.session).Store(&secret); err != nil {
+		return nil, err
+	}
+
+	var tokens TokenPair
+	if err := json.Unmarshal(secret.Value, &tokens); err != nil {
+		return nil, err
+	}
+
+	return &tokens, nil
+}
+
+// Save - replace the tokens of a profile
+func (s *secretServiceStore) Save(profile string, tokens *TokenPair) error {
+	value, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	if err := s.unlock([]dbus.ObjectPath{secretsCollection}); err != nil {
+		return err
+	}
+
+	props := map[string]dbus.Variant{
+		secretsItemIface + ".Label":      dbus.MakeVariant("otter heroku tokens (" + profile + ")"),
+		secretsItemIface + ".Attributes": dbus.MakeVariant(attributes(profile)),
+	}
+	secret := secretValue{Session: s.session, Parameters: []byte{}, Value: value, ContentType: "application/json"}
+
+	var item, prompt dbus.ObjectPath
+	collection := s.conn.Object(secretsBusName, secretsCollection)
+	if err := collection.Call(secretsCollectionIfc+".CreateItem", 0, props, secret, true).Store(&item, &prompt); err != nil {
+		return err
+	}
+
+	return s.prompt(prompt)
+}
+
+// Delete - remove the tokens of a profile
+func (s *secretServiceStore) Delete(profile string) error {
+	items, err := s.search(profile)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := s.conn.Object(secretsBusName, item).Call(secretsItemIface+".Delete", 0).Store(&prompt); err != nil {
+			return err
+		}
+
+		if err := s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List - profiles with stored tokens
+func (s *secretServiceStore) List() ([]string, error) {
+	items, err := s.search("")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, item := range items {
+		v, err := s.conn.Object(secretsBusName, item).GetProperty(secretsItemIface + ".Attributes")
+		if err != nil {
+			return nil, err
+		}
+
+		if attrs, ok := v.Value().(map[string]string); ok && attrs["profile"] != "" {
+			seen[attrs["profile"]] = true
+		}
+	}
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// search - items holding otter tokens, for a single profile unless it's empty
+func (s *secretServiceStore) search(profile string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+
+	attrs := map[string]string{secretsAttributeApp: secretsAttributeValue}
+	if profile != "" {
+		attrs = attributes(profile)
+	}
+
+	service := s.conn.Object(secretsBusName, secretsPath)
+	if err := service.Call(secretsServiceIface+".SearchItems", 0, attrs).Store(&unlocked, &locked); err != nil {
+		return nil, err
+	}
+
+	return append(unlocked, locked...), nil
+}
+
+// unlock - unlock items or collections, asking the user through the keyring prompt when needed
+func (s *secretServiceStore) unlock(paths []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+
+	service := s.conn.Object(secretsBusName, secretsPath)
+	if err := service.Call(secretsServiceIface+".Unlock", 0, paths).Store(&unlocked, &prompt); err != nil {
+		return err
+	}
+
+	return s.prompt(prompt)
+}
+
+// prompt - run a secret service prompt and wait for the user to complete it
+func (s *secretServiceStore) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == secretsNoPrompt {
+		return nil
+	}
+
+	if err := s.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretsPromptIface),
+		dbus.WithMatchMember("Completed"),
+	); err != nil {
+		return err
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(secretsBusName, prompt).Call(secretsPromptIface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+
+	timeout := time.After(secretsPromptTimeout)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || len(signal.Body) == 0 {
+				continue
+			}
+
+			if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+				return errors.New("keyring prompt was dismissed")
+			}
+
+			return nil
+		case <-timeout:
+			return errors.New("timed out waiting for the keyring prompt")
+		}
+	}
+}
+
+func attributes(profile string) map[string]string {
+	return map[string]string{
+		secretsAttributeApp: secretsAttributeValue,
+		"profile":           profile,
+	}
+}
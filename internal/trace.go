@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	redacted = "[REDACTED]"
+	// maxTraceBody - longest body printed in a trace, the rest is elided
+	maxTraceBody = 4096
+)
+
+// secretFields - json and form fields that are redacted wherever they appear
+var secretFields = map[string]bool{
+	"access_token":   true,
+	"refresh_token":  true,
+	"token":          true,
+	"client_secret":  true,
+	"code":           true,
+	"code_verifier":  true,
+	"session_secret": true,
+	"password":       true,
+}
+
+var debug struct {
+	enabled bool
+	unsafe  bool
+	out     io.Writer
+}
+
+// SetDebug - trace every outgoing http request and response to stderr
+// [enabled] - turn tracing on
+// [unsafe] - print secrets (authorization header, tokens, config var values) unredacted
+func SetDebug(enabled, unsafe bool) {
+	debug.enabled = enabled
+	debug.unsafe = unsafe
+	debug.out = os.Stderr
+}
+
+// traceTransport - logs requests and responses passing through the next transport
+type traceTransport struct {
+	next   http.RoundTripper
+	unsafe bool
+	out    io.Writer
+}
+
+// RoundTrip - log the request, send it and log the response
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		reqBody = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--> %s %s\n", req.Method, req.URL.String())
+	headers := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		headers = append(headers, k)
+	}
+	sort.Strings(headers)
+
+	for _, k := range headers {
+		value := strings.Join(req.Header[k], ", ")
+		if k == "Authorization" && !t.unsafe {
+			value = redacted
+		}
+		fmt.Fprintf(&sb, "    %s: %s\n", k, value)
+	}
+	if len(reqBody) > 0 {
+		fmt.Fprintf(&sb, "    %s\n", t.body(req.URL.Path, req.Header.Get("Content-Type"), reqBody))
+	}
+
+	fmt.Fprint(t.out, sb.String())
+	sb.Reset()
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		fmt.Fprintf(t.out, "<-- %s %s failed after %s: %s\n", req.Method, req.URL.String(), elapsed.Round(time.Millisecond), err.Error())
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	fmt.Fprintf(&sb, "<-- %s %s %s (%s)\n", resp.Status, req.Method, req.URL.String(), elapsed.Round(time.Millisecond))
+	for _, h := range []string{"Request-Id", "RateLimit-Remaining", "Retry-After", "Next-Range"} {
+		if v := resp.Header.Get(h); v != "" {
+			fmt.Fprintf(&sb, "    %s: %s\n", h, v)
+		}
+	}
+	if len(respBody) > 0 {
+		fmt.Fprintf(&sb, "    %s\n", t.body(req.URL.Path, resp.Header.Get("Content-Type"), respBody))
+	}
+
+	fmt.Fprint(t.out, sb.String())
+
+	return resp, nil
+}
+
+// body - render a body for the trace, redacting secrets unless tracing is unsafe
+func (t *traceTransport) body(path, contentType string, b []byte) string {
+	out := string(b)
+
+	if !t.unsafe {
+		if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+			out = redactForm(out)
+		} else {
+			out = redactJSON(b, strings.Contains(path, "/config-vars"))
+		}
+	}
+
+	out = strings.TrimSpace(out)
+	if len(out) > maxTraceBody {
+		out = out[:maxTraceBody] + fmt.Sprintf("... (%d bytes elided)", len(out)-maxTraceBody)
+	}
+
+	return out
+}
+
+// redactJSON - replace secret fields, or every value when the body holds config vars.
+// Bodies that aren't json are dropped entirely since they can't be inspected.
+// [allValues] - redact every top level value e.g. config vars
+func redactJSON(b []byte, allValues bool) string {
+	var v interface{}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Sprintf("<%d bytes of non-json body>", len(b))
+	}
+
+	if obj, ok := v.(map[string]interface{}); ok && allValues {
+		for k, val := range obj {
+			if val != nil {
+				obj[k] = redacted
+			}
+		}
+	} else {
+		v = redactValue(v)
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return redacted
+	}
+
+	return string(out)
+}
+
+// RedactFields - copy of the fields with secrets (tokens, codes, client secrets) redacted
+// at any depth, e.g. before they're logged
+// [fields] - fields to redact, left untouched
+func RedactFields(fields map[string]interface{}) map[string]interface{} {
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(b, &out); err != nil || out == nil {
+		return map[string]interface{}{}
+	}
+
+	redactValue(out)
+
+	return out
+}
+
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, field := range val {
+			if secretFields[k] && field != nil {
+				if _, nested := field.(map[string]interface{}); !nested {
+					val[k] = redacted
+					continue
+				}
+			}
+			val[k] = redactValue(field)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = redactValue(item)
+		}
+	}
+
+	return v
+}
+
+func redactForm(body string) string {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return redacted
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		v := values.Get(k)
+		if secretFields[k] {
+			v = redacted
+		}
+		pairs = append(pairs, k+"="+v)
+	}
+
+	return strings.Join(pairs, "&")
+}
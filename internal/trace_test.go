@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Request-Id", "req-123")
+		w.Write([]byte(`{"DATABASE_URL":"postgres://secret"}`))
+	}))
+	defer srv.Close()
+
+	t.Log("Should trace requests with secrets redacted")
+	{
+		var out bytes.Buffer
+		client := NewAPIClient(actk)
+		client.BaseURL = srv.URL
+		client.HTTPClient = &http.Client{Transport: &traceTransport{next: http.DefaultTransport, out: &out}}
+
+		if _, err := client.Do("PATCH", "/apps/otter/config-vars", map[string]string{"DATABASE_URL": "postgres://secret"}); err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
+		}
+
+		trace := out.String()
+		if strings.Contains(trace, actk) || strings.Contains(trace, "postgres://secret") {
+			t.Fatalf("\t%s\tShould not leak secrets:\n%s", failed, trace)
+		}
+
+		if !strings.Contains(trace, "PATCH "+srv.URL) || !strings.Contains(trace, "Request-Id: req-123") {
+			t.Fatalf("\t%s\tShould log the request and response:\n%s", failed, trace)
+		}
+
+		t.Logf("\t%s\tShould trace requests with secrets redacted", succeed)
+	}
+
+	t.Log("Should trace secrets when unsafe")
+	{
+		var out bytes.Buffer
+		client := NewAPIClient(actk)
+		client.BaseURL = srv.URL
+		client.HTTPClient = &http.Client{Transport: &traceTransport{next: http.DefaultTransport, out: &out, unsafe: true}}
+
+		if _, err := client.Do("GET", "/apps/otter/config-vars", nil); err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
+		}
+
+		if !strings.Contains(out.String(), actk) || !strings.Contains(out.String(), "postgres://secret") {
+			t.Fatalf("\t%s\tShould print secrets:\n%s", failed, out.String())
+		}
+
+		t.Logf("\t%s\tShould trace secrets when unsafe", succeed)
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	t.Log("Should redact secrets at any depth without touching the fields")
+	{
+		fields := map[string]interface{}{
+			"route":  "/auth/refresh",
+			"tokens": map[string]interface{}{"access_token": actk, "refresh_token": "rtk"},
+		}
+
+		out := RedactFields(fields)
+
+		tokens := out["tokens"].(map[string]interface{})
+		if tokens["access_token"] != redacted || tokens["refresh_token"] != redacted || out["route"] != "/auth/refresh" {
+			t.Fatalf("\t%s\tShould redact secrets: %v", failed, out)
+		}
+
+		if fields["tokens"].(map[string]interface{})["access_token"] != actk {
+			t.Fatalf("\t%s\tShould leave the fields untouched", failed)
+		}
+
+		if RedactFields(nil) == nil {
+			t.Fatalf("\t%s\tShould return an empty map for nil fields", failed)
+		}
+
+		t.Logf("\t%s\tShould redact secrets at any depth without touching the fields", succeed)
+	}
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// DEFAULT_TIMEOUT - per request timeout when none is configured
+const DEFAULT_TIMEOUT = 30 * time.Second
+
+var transport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+// ConfigureTransport - set up the transport shared by every outgoing request.
+// Proxies are taken from HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+// [caFile] - pem bundle trusted in addition to the system roots, empty for none
+// [timeout] - per request timeout, zero for the default
+func ConfigureTransport(caFile string, timeout time.Duration) error {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("couldn't read ca file: %s", err.Error())
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in ca file " + caFile)
+		}
+
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	if timeout <= 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+
+	transport.base = t
+	transport.timeout = timeout
+
+	return nil
+}
+
+// HTTPClient - http client used for every outgoing request
+func HTTPClient() *http.Client {
+	base := transport.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	timeout := transport.timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+
+	var rt http.RoundTripper = base
+	if debug.enabled {
+		rt = &traceTransport{next: base, unsafe: debug.unsafe, out: debug.out}
+	}
+
+	return &http.Client{Transport: rt, Timeout: timeout}
+}
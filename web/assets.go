@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// assets - templates and static files, embedded so the relay runs from any directory
+//
+//go:embed templates static
+var assets embed.FS
+
+// pageNames - pages the relay renders, each one a templates/<name>.html filling in the layout
+var pageNames = []string{"redirect", "success", "error", "denied", "expired"}
+
+// pages - parsed pages by name
+var pages = parsePages()
+
+// parsePages - parse every page along with the layout, panics on a broken template
+func parsePages() map[string]*template.Template {
+	parsed := map[string]*template.Template{}
+
+	for _, name := range pageNames {
+		parsed[name] = template.Must(template.ParseFS(assets, "templates/layout.html", "templates/"+name+".html"))
+	}
+
+	return parsed
+}
+
+// renderPage - render a page, nothing is written when the template fails
+// [status] - response status code
+// [name] - page name, see pageNames
+// [data] - template data
+func renderPage(w http.ResponseWriter, status int, name string, data map[string]interface{}) {
+	var buf bytes.Buffer
+
+	if err := pages[name].ExecuteTemplate(&buf, "layout", data); err != nil {
+		logEvent("error", "couldn't render page", logFields{"page": name, "error": err.Error()})
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'self'; img-src 'self'; form-action 'none'; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// renderError - error page of a failed login
+// [status] - response status code
+// [title] - page heading
+// [message] - what happened and what to do about it
+func renderError(w http.ResponseWriter, status int, title, message string) {
+	renderPage(w, status, "error", map[string]interface{}{
+		"title":   title,
+		"message": message,
+	})
+}
+
+// staticHandler - serves the embedded static files under /static/
+func staticHandler() http.Handler {
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// no directory listings
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ID_URL - heroku's identity server, overridden e.g. to run the relay against a local fake
+const ID_URL = "https://id.heroku.com"
+
+// envConfig - relay settings. Flags take precedence over env vars, which take precedence over
+// the config file.
+type envConfig struct {
+	Port          string
+	OauthClientID string
+	OauthSecret   string
+	IDURL         string
+	CaFile        string
+	HTTPTimeout   time.Duration
+	MetricsToken  string
+}
+
+// configSetting - a relay setting, named key in the config file, -key as a flag with
+// underscores as dashes, and env as an env var
+type configSetting struct {
+	key      string
+	env      string
+	usage    string
+	required bool
+}
+
+var configSettings = []configSetting{
+	{"port", "PORT", "port to listen on", true},
+	{"oauth_client_id", "OAUTH_CLIENT_ID", "id of otter's heroku oauth client", true},
+	{"oauth_secret", "OAUTH_SECRET", "secret of otter's heroku oauth client", true},
+	{"id_url", "ID_URL", "heroku identity server (default " + ID_URL + ")", false},
+	{"ca_file", "CA_FILE", "pem bundle of extra root certificates", false},
+	{"http_timeout", "HTTP_TIMEOUT", "timeout of requests to heroku e.g. 30s", false},
+	{"metrics_token", "METRICS_TOKEN", "bearer token required to scrape /metrics", false},
+}
+
+// errConfig - every problem found in the relay config
+type errConfig struct {
+	problems []string
+}
+
+func (e *errConfig) Error() string {
+	return "invalid relay config:\n  - " + strings.Join(e.problems, "\n  - ")
+}
+
+// config - settings of the running relay
+var config = &envConfig{IDURL: ID_URL}
+
+// loadConfig - read the relay settings from flags, env vars and the config file, then check them
+// [args] - command line arguments without the program name
+// [getenv] - env lookup e.g. os.Getenv
+func loadConfig(args []string, getenv func(string) string) (*envConfig, error) {
+	fs := flag.NewFlagSet("otter-web", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("RELAY_CONFIG"), "yaml file of relay settings (env RELAY_CONFIG)")
+
+	flags := map[string]*string{}
+	for _, s := range configSettings {
+		flags[s.key] = fs.String(strings.Replace(s.key, "_", "-", -1), "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+
+	if *configFile != "" {
+		b, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read config file - %s", err.Error())
+		}
+
+		var file map[string]interface{}
+		if err := yaml.Unmarshal(b, &file); err != nil {
+			return nil, fmt.Errorf("couldn't parse config file %s - %s", *configFile, err.Error())
+		}
+
+		for key, v := range file {
+			values[key] = fmt.Sprint(v)
+		}
+	}
+
+	var problems []string
+	known := map[string]bool{}
+
+	for _, s := range configSettings {
+		known[s.key] = true
+
+		if v := getenv(s.env); v != "" {
+			values[s.key] = v
+		}
+
+		if v := *flags[s.key]; v != "" {
+			values[s.key] = v
+		}
+
+		if s.required && values[s.key] == "" {
+			problems = append(problems, fmt.Sprintf("missing %s - set %s, pass -%s or add %s to the config file", s.key, s.env, strings.Replace(s.key, "_", "-", -1), s.key))
+		}
+	}
+
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+
+	for _, key := range unknown {
+		problems = append(problems, fmt.Sprintf("unknown setting %s in the config file", key))
+	}
+
+	c := &envConfig{
+		Port:          values["port"],
+		OauthClientID: values["oauth_client_id"],
+		OauthSecret:   values["oauth_secret"],
+		IDURL:         strings.TrimSuffix(values["id_url"], "/"),
+		CaFile:        values["ca_file"],
+		MetricsToken:  values["metrics_token"],
+	}
+
+	if c.Port != "" {
+		if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("invalid port %s - expected a number between 1 and 65535", c.Port))
+		}
+	}
+
+	if c.IDURL == "" {
+		c.IDURL = ID_URL
+	} else if u, err := url.Parse(c.IDURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("invalid id_url %s - expected an http(s) url", c.IDURL))
+	}
+
+	if timeout := values["http_timeout"]; timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			problems = append(problems, fmt.Sprintf("invalid http_timeout %s - expected a duration e.g. 30s", timeout))
+		}
+		c.HTTPTimeout = d
+	}
+
+	if len(problems) > 0 {
+		return nil, &errConfig{problems: problems}
+	}
+
+	return c, nil
+}
+
+// configProblems - problems of a config error, for the log
+func configProblems(err error) []string {
+	var invalid *errConfig
+	if errors.As(err, &invalid) {
+		return invalid.problems
+	}
+
+	return []string{err.Error()}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env - env lookup backed by a map
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otter-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "relay.yaml")
+	if err := ioutil.WriteFile(file, []byte("port: 5000\noauth_client_id: file-client\noauth_secret: file-secret\nhttp_timeout: 20s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("Should list every missing and invalid setting at once")
+	{
+		_, err := loadConfig([]string{"-http-timeout", "soon"}, env(map[string]string{"ID_URL": "id.heroku.com"}))
+		if err == nil {
+			t.Fatalf("\t%s\tShould return an error", failed)
+		}
+
+		problems := configProblems(err)
+		for _, want := range []string{"missing port", "missing oauth_client_id", "missing oauth_secret", "invalid id_url", "invalid http_timeout"} {
+			found := false
+			for _, p := range problems {
+				found = found || strings.HasPrefix(p, want)
+			}
+
+			if !found {
+				t.Fatalf("\t%s\tShould report %q: %v", failed, want, problems)
+			}
+		}
+
+		t.Logf("\t%s\tShould list every missing and invalid setting at once", succeed)
+	}
+
+	t.Log("Should prefer flags over env vars over the config file")
+	{
+		c, err := loadConfig([]string{"-config", file, "-port", "7000"}, env(map[string]string{"PORT": "6000", "OAUTH_SECRET": "env-secret"}))
+		if err != nil {
+			t.Fatalf("\t%s\tShould not return an error: %v", failed, err)
+		}
+
+		if c.Port != "7000" || c.OauthSecret != "env-secret" || c.OauthClientID != "file-client" || c.HTTPTimeout != 20*time.Second {
+			t.Fatalf("\t%s\tShould merge the sources in order: %+v", failed, c)
+		}
+
+		if c.IDURL != ID_URL {
+			t.Fatalf("\t%s\tShould default to heroku's identity server: %s", failed, c.IDURL)
+		}
+
+		t.Logf("\t%s\tShould prefer flags over env vars over the config file", succeed)
+	}
+
+	t.Log("Should point the relay at another identity server")
+	{
+		c, err := loadConfig([]string{"-config", file, "-id-url", "http://127.0.0.1:5050/"}, env(nil))
+		if err != nil || c.IDURL != "http://127.0.0.1:5050" {
+			t.Fatalf("\t%s\tShould use the id url: %v %v", failed, c, err)
+		}
+
+		t.Logf("\t%s\tShould point the relay at another identity server", succeed)
+	}
+}
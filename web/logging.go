@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mayowa-Ojo/otter/internal"
+	"github.com/gorilla/mux"
+)
+
+// logFields - context of a log line
+type logFields map[string]interface{}
+
+var logger = struct {
+	mu  sync.Mutex
+	out io.Writer
+}{out: os.Stdout}
+
+// logEvent - write a json log line to stdout. Tokens, codes and secrets are redacted wherever
+// they appear in the fields.
+// [level] - info, warn or error
+// [msg] - what happened
+// [fields] - context of the event, may be nil
+func logEvent(level, msg string, fields logFields) {
+	entry := internal.RedactFields(fields)
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["msg"] = msg
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.out.Write(append(b, '\n'))
+}
+
+// statusRecorder - remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests - log every request and observe its latency. Query strings carry oauth codes
+// and states, so only the route is logged.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		// unmatched paths share a label, there's no end to them
+		route := "not_found"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		elapsed := time.Since(start)
+		metrics.requestDuration.observe(route, elapsed)
+
+		logEvent("info", "request", logFields{
+			"method":      r.Method,
+			"route":       route,
+			"status":      rec.status,
+			"duration_ms": float64(elapsed.Microseconds()) / 1000,
+			"remote_ip":   clientIP(r),
+		})
+	})
+}
+
+// clientIP - address of the client. heroku's router appends it to X-Forwarded-For, anything
+// before it was sent by the client and can't be trusted.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		return strings.TrimSpace(hops[len(hops)-1])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
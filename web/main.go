@@ -3,239 +3,426 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"html/template"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/Mayowa-Ojo/otter/internal"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
 
-var config *envConfig
+func main() {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		logEvent("error", "couldn't load env file", logFields{"error": err.Error()})
+	}
 
-func init() {
-	config = newEnvConfig()
-}
+	c, err := loadConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		logEvent("error", "refusing to start with an invalid config", logFields{"problems": configProblems(err)})
+		os.Exit(1)
+	}
 
-func main() {
-	r := mux.NewRouter()
+	config = c
+
+	if err := internal.ConfigureTransport(config.CaFile, config.HTTPTimeout); err != nil {
+		logEvent("error", "invalid transport config", logFields{"error": err.Error()})
+		os.Exit(1)
+	}
 
 	srv := &http.Server{
 		Addr:         ":" + config.Port,
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
-		Handler:      r,
+		Handler:      newRouter(),
+	}
+
+	go func() {
+		logEvent("info", "starting web server", logFields{"port": config.Port})
+
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logEvent("error", "server failed", logFields{"error": err.Error()})
+			os.Exit(1)
+		}
+	}()
+
+	// heroku sends SIGTERM on restarts and deploys, and kills the dyno 30s later
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	sig := <-stop
+
+	draining.Store(true)
+	logEvent("info", "shutting down", logFields{"signal": sig.String()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logEvent("error", "requests were cut off by the shutdown", logFields{"error": err.Error()})
+		os.Exit(1)
 	}
 
-	redirectTmpl := template.Must(template.ParseFiles("./web/templates/redirect.html"))
-	successTmpl := template.Must(template.ParseFiles("./web/templates/success.html"))
+	logEvent("info", "server stopped", nil)
+}
+
+// newRouter - routes of the relay
+func newRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(logRequests)
 
-	r.HandleFunc("/auth/callback", handleOauthCallback(successTmpl)).Methods("GET")
+	r.HandleFunc("/auth/callback", handleOauthCallback).Methods("GET")
 	r.HandleFunc("/auth/refresh", handleRefreshToken).Methods("POST")
-	r.HandleFunc("/auth", handleClientOauth(redirectTmpl)).Methods("GET")
+	r.HandleFunc("/auth/session", handlePollSession).Methods("POST")
+	r.HandleFunc("/auth/success", func(w http.ResponseWriter, r *http.Request) {
+		renderPage(w, http.StatusOK, "success", nil)
+	}).Methods("GET")
+	r.HandleFunc("/auth", handleClientOauth).Methods("GET")
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Up and running"))
 	}).Methods("GET")
+	r.HandleFunc("/ready", handleReady).Methods("GET")
+	r.HandleFunc("/metrics", handleMetrics).Methods("GET")
+	r.PathPrefix("/static/").Handler(staticHandler()).Methods("GET", "HEAD")
+	// middleware only runs on matched routes, 404s are logged and timed here
+	r.NotFoundHandler = logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderError(w, http.StatusNotFound, "Page not found", "There's nothing here - logins start with otter auth.")
+	}))
+
+	return r
+}
 
-	fmt.Println("Starting web server...http://127.0.0.1:" + config.Port)
+// shutdownTimeout - how long requests in flight may take to finish after SIGTERM
+const shutdownTimeout = 25 * time.Second
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatal("[Error] --server: ", err.Error())
-	}
-}
+// draining - set once the relay is shutting down
+var draining atomic.Value
 
-func handleClientOauth(tmpl *template.Template) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+// reachabilityTTL - how long the outcome of probing heroku's identity server is reused, so
+// frequent readiness checks don't turn into requests to heroku
+const reachabilityTTL = 30 * time.Second
 
-		clientID := config.OauthClientID
-		scope := "read-protected write-protected"
-		state := config.CsrfToken
-		uri := fmt.Sprintf("https://id.heroku.com/oauth/authorize?client_id=%s&response_type=code&scope=%s&state=%s", clientID, scope, state)
+// reachability - cached outcome of the last probe of heroku's identity server
+type reachability struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
 
-		data := map[string]interface{}{
-			"authUrl": uri,
-		}
+var idReachability = &reachability{}
 
-		w.Header().Set("Content-type", "text/html")
-		if err := tmpl.Execute(w, data); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// check - error of the last probe, probing again once it's older than reachabilityTTL.
+// Concurrent checks wait for a single probe.
+// [uri] - identity server to probe
+func (c *reachability) check(uri string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checked.IsZero() && time.Since(c.checked) < reachabilityTTL {
+		return c.err
 	}
-}
 
-func handleOauthCallback(tmpl *template.Template) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query()["code"][0]
-		state := r.URL.Query()["state"][0]
-		var tokenData map[string]interface{}
+	c.err = probe(uri)
+	c.checked = time.Now()
 
-		if state != config.CsrfToken {
-			http.Error(w, errors.New("authorization failed").Error(), http.StatusUnauthorized)
-			return
-		}
+	return c.err
+}
 
-		// handle token exchange
-		uri := fmt.Sprintf("https://id.heroku.com/oauth/token")
+// probe - whether a server answers at all, any response short of a 5xx will do
+// [uri] - server to probe
+func probe(uri string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-		d := url.Values{}
-		d.Set("grant_type", "authorization_code")
-		d.Set("code", code)
-		d.Set("client_secret", config.OauthSecret)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", uri, nil)
+	if err != nil {
+		return err
+	}
 
-		client := &http.Client{}
+	resp, err := internal.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
 
-		req, err := http.NewRequest("POST", uri, strings.NewReader(d.Encode()))
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("responded %d", resp.StatusCode)
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+	return nil
+}
 
-		defer resp.Body.Close()
+// handleReady - readiness check: 503 while the oauth client is missing, heroku's identity server
+// can't be reached or the relay is shutting down
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"draining": "ok", "oauth_client": "ok", "identity_server": "ok"}
+	status := http.StatusOK
 
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	if d, _ := draining.Load().(bool); d {
+		checks["draining"] = "shutting down"
+		status = http.StatusServiceUnavailable
+	}
 
-		if err := json.Unmarshal(b, &tokenData); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	if config.OauthClientID == "" || config.OauthSecret == "" {
+		checks["oauth_client"] = "missing"
+		status = http.StatusServiceUnavailable
+	}
 
-		if _, ok := tokenData["access_token"]; !ok {
-			http.Error(w, errors.New("authorization failed").Error(), http.StatusInternalServerError)
-			return
-		}
+	if err := idReachability.check(config.IDURL); err != nil {
+		checks["identity_server"] = "unreachable - " + err.Error()
+		status = http.StatusServiceUnavailable
+	}
 
-		uri = fmt.Sprintf("http://localhost:7070/auth/callback")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"checks": checks})
+}
 
-		data, err := json.Marshal(map[string]string{
-			"access_token":  tokenData["access_token"].(string),
-			"refresh_token": tokenData["refresh_token"].(string),
-		})
+// handleClientOauth - start a login and send the browser on to heroku. The redirect page works
+// without javascript.
+func handleClientOauth(w http.ResponseWriter, r *http.Request) {
+	if ok, retry := loginLimit.allow(clientIP(r)); !ok {
+		setRetryAfter(w, retry)
+		renderError(w, http.StatusTooManyRequests, "Too many logins", "This network started too many logins in a short time - run otter auth again in a minute.")
+		return
+	}
 
-		body := bytes.NewBuffer(data)
+	query := r.URL.Query()
+	var cli cliSession
 
-		req, err = http.NewRequest("POST", uri, body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	// a callback the relay can't send the browser to safely makes the login headless, the cli polls anyway
+	if port, err := callbackPort(query.Get("port")); err == nil {
+		if host, err := callbackHost(query.Get("host")); err == nil {
+			cli.host, cli.port = host, port
 		}
+	}
 
-		if _, err := client.Do(req); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+	// the cli collects its tokens with the secret behind the session id, the browser only
+	// ever learns that the login is done
+	session := query.Get("session")
+	if !sessionID.MatchString(session) {
+		renderError(w, http.StatusBadRequest, "Unsupported otter version", "This version of otter can't log in through the relay anymore - upgrade otter and run otter auth again.")
+		return
+	}
 
-		w.Header().Set("Content-type", "text/html")
-		if err := tmpl.Execute(w, nil); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// older clis don't ask for scopes and get the default ones
+	scopes, err := internal.ParseScopes([]string{query.Get("scope")})
+	if err != nil {
+		renderError(w, http.StatusBadRequest, "Unknown scope", "Otter asked for a scope heroku doesn't grant ("+err.Error()+") - run otter auth again with a valid --scope.")
+		return
+	}
+
+	if err := sessions.start(session); err != nil {
+		renderError(w, http.StatusServiceUnavailable, "Too many logins", "The relay is handling too many logins right now - run otter auth again in a few minutes.")
+		return
+	}
+
+	cli.session = session
+	cli.scope = strings.Join(scopes, " ")
+
+	state, err := states.mint(cli)
+	if errors.Is(err, errTooManyStates) {
+		renderError(w, http.StatusServiceUnavailable, "Too many logins", "The relay is handling too many logins right now - run otter auth again in a few minutes.")
+		return
 	}
+	if err != nil {
+		renderError(w, http.StatusInternalServerError, "Something went wrong", "Couldn't start the login - try again.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/auth",
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	params := url.Values{}
+	params.Set("client_id", config.OauthClientID)
+	params.Set("response_type", "code")
+	params.Set("scope", cli.scope)
+	params.Set("state", state)
+	uri := fmt.Sprintf("%s/oauth/authorize?%s", config.IDURL, params.Encode())
+
+	renderPage(w, http.StatusOK, "redirect", map[string]interface{}{
+		"authUrl": uri,
+	})
 }
 
-func handleRefreshToken(w http.ResponseWriter, r *http.Request) {
-	var reqBody map[string]interface{}
-	uri := fmt.Sprintf("https://id.heroku.com/oauth/token")
+// handleOauthCallback - heroku sends the browser back here once the user has decided, the tokens
+// are then handed to the cli's session
+func handleOauthCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	state := query.Get("state")
+	var tokenData map[string]interface{}
 
-	b, err := ioutil.ReadAll(r.Body)
+	// the state has to come back to the browser that started the login
+	cookie, err := r.Cookie(stateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		metrics.logins.inc("expired")
+		renderPage(w, http.StatusBadRequest, "expired", map[string]interface{}{"message": "This login link has expired or was started in another browser."})
+		return
+	}
+
+	cli, err := states.consume(state)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		metrics.logins.inc("expired")
+		renderPage(w, http.StatusBadRequest, "expired", map[string]interface{}{"message": "This login link has expired or was already used."})
 		return
 	}
 
-	if err := json.Unmarshal(b, &reqBody); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Value: "", Path: "/auth", MaxAge: -1})
+
+	if reason := query.Get("error"); reason != "" {
+		metrics.logins.inc("denied")
+		renderPage(w, http.StatusForbidden, "denied", map[string]interface{}{"reason": reason})
 		return
 	}
 
-	if _, ok := reqBody["refresh_token"]; !ok {
-		http.Error(w, errors.New("msising field in request body").Error(), http.StatusBadRequest)
+	code := query.Get("code")
+	if code == "" {
+		metrics.logins.inc("failed")
+		renderError(w, http.StatusBadRequest, "Authorization failed", "Heroku didn't send an authorization code - run otter auth again.")
 		return
 	}
 
 	d := url.Values{}
-	d.Set("grant_type", "refresh_token")
-	d.Set("refresh_token", reqBody["refresh_token"].(string))
+	d.Set("grant_type", "authorization_code")
+	d.Set("code", code)
 	d.Set("client_secret", config.OauthSecret)
 
-	client := &http.Client{}
+	status, b, err := requestToken(d)
+	if err != nil || status != http.StatusOK {
+		metrics.logins.inc("failed")
+		logEvent("error", "code exchange failed", logFields{"status": status, "error": errString(err)})
+		renderError(w, http.StatusBadGateway, "Authorization failed", "Heroku didn't hand out tokens for this login - run otter auth again.")
+		return
+	}
 
-	req, err := http.NewRequest("POST", uri, strings.NewReader(d.Encode()))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := json.Unmarshal(b, &tokenData); err != nil || tokenData["access_token"] == nil {
+		metrics.logins.inc("failed")
+		logEvent("error", "code exchange returned no tokens", nil)
+		renderError(w, http.StatusBadGateway, "Authorization failed", "Heroku didn't hand out tokens for this login - run otter auth again.")
 		return
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// heroku grants all of the scopes asked for or none
+	scope := cli.scope
+	if granted, ok := tokenData["scope"].(string); ok && granted != "" {
+		scope = granted
 	}
 
-	defer resp.Body.Close()
+	tokens := map[string]interface{}{
+		"access_token":  tokenData["access_token"],
+		"refresh_token": tokenData["refresh_token"],
+		"expires_in":    tokenData["expires_in"],
+		"scope":         scope,
+	}
 
-	if resp.StatusCode != 200 {
-		http.Error(w, errors.New("authentication failed").Error(), http.StatusInternalServerError)
+	if !sessions.complete(cli.session, tokens) {
+		metrics.logins.inc("expired")
+		renderPage(w, http.StatusGone, "expired", map[string]interface{}{"message": "The otter session waiting for this login has expired."})
 		return
 	}
 
-	var tokenData map[string]interface{}
+	metrics.logins.inc("success")
+	logEvent("info", "login completed", logFields{"headless": cli.port == 0, "scope": scope})
 
-	b, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// wake up the cli's callback server, it then collects the tokens from the relay.
+	// headless clis and clis on another machine keep polling instead.
+	if cli.port != 0 {
+		http.Redirect(w, r, fmt.Sprintf("http://%s/auth/callback", net.JoinHostPort(cli.host, strconv.Itoa(cli.port))), http.StatusFound)
 		return
 	}
 
-	if err := json.Unmarshal(b, &tokenData); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	renderPage(w, http.StatusOK, "success", nil)
+}
+
+// callbackHost - validate the callback host sent by the cli, which only ever listens on loopback.
+// Older clis don't send one and listen on 127.0.0.1.
+func callbackHost(value string) (string, error) {
+	if value == "" {
+		return "127.0.0.1", nil
 	}
 
-	if _, ok := tokenData["access_token"]; !ok {
-		http.Error(w, errors.New("authorization failed").Error(), http.StatusInternalServerError)
-		return
+	if ip := net.ParseIP(value); value != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", errors.New("invalid callback host")
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(b)
+	return value, nil
 }
 
-type envConfig struct {
-	Port          string `mapstructure:"PORT"`
-	OauthClientID string `mapstructure:"OAUTH_CLIENT_ID"`
-	OauthSecret   string `mapstructure:"OAUTH_SECRET"`
-	CsrfToken     string `mapstructure:"CSRF_TOKEN"`
+// callbackPort - validate the callback port sent by the cli
+func callbackPort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1024 || port > 65535 {
+		return 0, errors.New("invalid callback port")
+	}
+
+	return port, nil
 }
 
-func newEnvConfig() *envConfig {
-	var config envConfig
+// requestToken - post a grant to heroku's token endpoint, timing it and counting failures
+// [form] - grant, with the client secret
+func requestToken(form url.Values) (int, []byte, error) {
+	start := time.Now()
+	defer func() {
+		metrics.upstreamDuration.observe("token", time.Since(start))
+	}()
 
-	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
-		log.Printf("[Error] --config: couldn't load env file - %s", err.Error())
+	req, err := http.NewRequest("POST", config.IDURL+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, nil, err
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	config.Port = os.Getenv("PORT")
-	config.OauthClientID = os.Getenv("OAUTH_CLIENT_ID")
-	config.OauthSecret = os.Getenv("OAUTH_SECRET")
-	config.CsrfToken = os.Getenv("CSRF_TOKEN")
+	resp, err := internal.HTTPClient().Do(req)
+	if err != nil {
+		metrics.upstreamFailures.inc("token")
+		return 0, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		metrics.upstreamFailures.inc("token")
+		return 0, nil, err
+	}
+
+	if resp.StatusCode >= 500 {
+		metrics.upstreamFailures.inc("token")
+	}
+
+	return resp.StatusCode, b, nil
+}
+
+// errString - message of an error that may be nil
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
 
-	return &config
+	return err.Error()
 }
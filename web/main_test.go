@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	probes := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	logger.out = ioutil.Discard
+	defer func(r *reachability) { idReachability = r }(idReachability)
+
+	t.Log("Should be ready with an oauth client and a reachable identity server")
+	{
+		config = &envConfig{IDURL: upstream.URL, OauthClientID: "client", OauthSecret: "secret"}
+		idReachability = &reachability{}
+
+		for i := 0; i < 3; i++ {
+			if rec := get("/ready"); rec.Code != http.StatusOK {
+				t.Fatalf("\t%s\tShould be ready: %d\n%s", failed, rec.Code, rec.Body.String())
+			}
+		}
+
+		if probes != 1 {
+			t.Fatalf("\t%s\tShould reuse the last probe: %d probes", failed, probes)
+		}
+
+		t.Logf("\t%s\tShould be ready with an oauth client and a reachable identity server", succeed)
+	}
+
+	t.Log("Should not be ready without an oauth client")
+	{
+		config = &envConfig{IDURL: upstream.URL, OauthClientID: "client"}
+
+		rec := get("/ready")
+		if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"oauth_client":"missing"`) {
+			t.Fatalf("\t%s\tShould report the missing client: %d\n%s", failed, rec.Code, rec.Body.String())
+		}
+
+		t.Logf("\t%s\tShould not be ready without an oauth client", succeed)
+	}
+
+	t.Log("Should not be ready while the identity server can't be reached")
+	{
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		config = &envConfig{IDURL: down.URL, OauthClientID: "client", OauthSecret: "secret"}
+		idReachability = &reachability{}
+
+		rec := get("/ready")
+		if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"identity_server":"unreachable`) {
+			t.Fatalf("\t%s\tShould report the identity server: %d\n%s", failed, rec.Code, rec.Body.String())
+		}
+
+		t.Logf("\t%s\tShould not be ready while the identity server can't be reached", succeed)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets - upper bounds in seconds of the latency histograms
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// counterVec - counter partitioned by a single label
+type counterVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	return &counterVec{name: name, help: help, label: label, values: map[string]float64{}}
+}
+
+// inc - add one to the counter of a label value
+func (c *counterVec) inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[value]++
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, value := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", c.name, c.label, value, formatFloat(c.values[value]))
+	}
+}
+
+// histogram - observations of a single label value
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// histogramVec - latency histogram partitioned by a single label
+type histogramVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func newHistogramVec(name, help, label string) *histogramVec {
+	return &histogramVec{name: name, help: help, label: label, series: map[string]*histogram{}}
+}
+
+// observe - record a duration for a label value
+func (h *histogramVec) observe(value string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[value]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		h.series[value] = s
+	}
+
+	seconds := d.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += seconds
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	values := make([]string, 0, len(h.series))
+	for value := range h.series {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, value := range values {
+		s := h.series[value]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s=%q,le=%q} %d\n", h.name, h.label, value, formatFloat(bound), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", h.name, h.label, value, s.count)
+		fmt.Fprintf(w, "%s_sum{%s=%q} %s\n", h.name, h.label, value, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s=%q} %d\n", h.name, h.label, value, s.count)
+	}
+}
+
+// metrics - everything the relay exposes on /metrics
+var metrics = struct {
+	logins           *counterVec
+	refreshes        *counterVec
+	upstreamFailures *counterVec
+	upstreamDuration *histogramVec
+	requestDuration  *histogramVec
+}{
+	logins:           newCounterVec("otter_relay_logins_total", "Logins through the relay by result.", "result"),
+	refreshes:        newCounterVec("otter_relay_refreshes_total", "Token refreshes through the relay by result.", "result"),
+	upstreamFailures: newCounterVec("otter_relay_upstream_failures_total", "Failed requests to heroku's identity server.", "endpoint"),
+	upstreamDuration: newHistogramVec("otter_relay_upstream_duration_seconds", "Latency of requests to heroku's identity server.", "endpoint"),
+	requestDuration:  newHistogramVec("otter_relay_http_request_duration_seconds", "Latency of requests served by the relay.", "route"),
+}
+
+// handleMetrics - metrics in the prometheus text format. Scrapers authenticate with
+// METRICS_TOKEN as a bearer token when it's set.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	// compared in constant time so the token can't be guessed byte by byte from response times
+	authorized := subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+config.MetricsToken)) == 1
+	if config.MetricsToken != "" && !authorized {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metrics.logins.write(w)
+	metrics.refreshes.write(w)
+	metrics.upstreamFailures.write(w)
+	metrics.upstreamDuration.write(w)
+	metrics.requestDuration.write(w)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
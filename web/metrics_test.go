@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	config = &envConfig{IDURL: ID_URL, OauthClientID: "client", OauthSecret: "secret", MetricsToken: "scrape"}
+	logger.out = ioutil.Discard
+
+	// scrape - fetch /metrics with an Authorization header, none when it's empty
+	scrape := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Log("Should only serve metrics to scrapers with the token")
+	{
+		for _, authorization := range []string{"", "Bearer scrap", "Bearer scrapes", "scrape"} {
+			if rec := scrape(authorization); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("\t%s\tShould reject %q: %d", failed, authorization, rec.Code)
+			}
+		}
+
+		rec := scrape("Bearer scrape")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "otter_relay_logins_total") {
+			t.Fatalf("\t%s\tShould serve the metrics: %d\n%s", failed, rec.Code, rec.Body.String())
+		}
+
+		t.Logf("\t%s\tShould only serve metrics to scrapers with the token", succeed)
+	}
+
+	t.Log("Should count requests to unknown pages under a single route")
+	{
+		if rec := get("/wp-login.php"); rec.Code != http.StatusNotFound {
+			t.Fatalf("\t%s\tShould not find the page: %d", failed, rec.Code)
+		}
+
+		body := scrape("Bearer scrape").Body.String()
+		if !strings.Contains(body, `otter_relay_http_request_duration_seconds_count{route="not_found"} `) || strings.Contains(body, "wp-login") {
+			t.Fatalf("\t%s\tShould time the 404 as not_found:\n%s", failed, body)
+		}
+
+		t.Logf("\t%s\tShould count requests to unknown pages under a single route", succeed)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// get - send a GET through the relay's router
+func get(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestLoginPages(t *testing.T) {
+	config = &envConfig{IDURL: ID_URL, OauthClientID: "client", OauthSecret: "secret"}
+	logger.out = ioutil.Discard
+
+	session := strings.Repeat("a", 64)
+
+	t.Log("Should redirect to heroku without javascript or third-party assets")
+	{
+		rec := get("/auth?session=" + session + "&scope=read")
+		body := rec.Body.String()
+
+		if rec.Code != http.StatusOK || !strings.Contains(body, `http-equiv="refresh"`) || !strings.Contains(body, `href="https://id.heroku.com/oauth/authorize?`) {
+			t.Fatalf("\t%s\tShould render the redirect page: %d\n%s", failed, rec.Code, body)
+		}
+
+		if strings.Contains(body, "<script") || strings.Contains(body, "unpkg.com") {
+			t.Fatalf("\t%s\tShould not need scripts or a cdn:\n%s", failed, body)
+		}
+
+		t.Logf("\t%s\tShould redirect to heroku without javascript or third-party assets", succeed)
+	}
+
+	t.Log("Should render the denied page, then the expired page for a used login link")
+	{
+		rec := get("/auth?session=" + session)
+
+		var state *http.Cookie
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == stateCookie {
+				state = c
+			}
+		}
+
+		if state == nil {
+			t.Fatalf("\t%s\tShould set the state cookie", failed)
+		}
+
+		rec = get("/auth/callback?error=access_denied&state="+state.Value, state)
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "Authorization denied") || !strings.Contains(rec.Body.String(), "access_denied") {
+			t.Fatalf("\t%s\tShould render the denied page: %d\n%s", failed, rec.Code, rec.Body.String())
+		}
+
+		rec = get("/auth/callback?code=code&state="+state.Value, state)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Login expired") {
+			t.Fatalf("\t%s\tShould render the expired page: %d\n%s", failed, rec.Code, rec.Body.String())
+		}
+
+		t.Logf("\t%s\tShould render the denied page, then the expired page for a used login link", succeed)
+	}
+
+	t.Log("Should serve the embedded stylesheet")
+	{
+		rec := get("/static/otter.css")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/css") {
+			t.Fatalf("\t%s\tShould serve the stylesheet: %d %s", failed, rec.Code, rec.Header().Get("Content-Type"))
+		}
+
+		if rec := get("/static/"); rec.Code != http.StatusNotFound {
+			t.Fatalf("\t%s\tShould not list the static files: %d", failed, rec.Code)
+		}
+
+		t.Logf("\t%s\tShould serve the embedded stylesheet", succeed)
+	}
+
+	t.Log("Should render an error page for unknown pages and old clis")
+	{
+		if rec := get("/nope"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "Page not found") {
+			t.Fatalf("\t%s\tShould render the not found page: %d", failed, rec.Code)
+		}
+
+		if rec := get("/auth?port=5000"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Unsupported otter version") {
+			t.Fatalf("\t%s\tShould render the upgrade page: %d", failed, rec.Code)
+		}
+
+		t.Logf("\t%s\tShould render an error page for unknown pages and old clis", succeed)
+	}
+}
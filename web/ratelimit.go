@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter - fixed window limit of requests per key e.g. client ip
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastPurge time.Time
+}
+
+// rateWindow - requests of a key in the current window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// newRateLimiter - allow limit requests per key in every window
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, windows: map[string]*rateWindow{}}
+}
+
+// allow - count a request of the key, false with the time until the window resets once
+// the key is over its limit
+// [key] - what the limit applies to
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastPurge) > l.window {
+		l.purge(now)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+
+	w.count++
+	return true, 0
+}
+
+// purge - drop windows that have ended, callers hold the lock
+func (l *rateLimiter) purge(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.lastPurge = now
+}
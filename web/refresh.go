@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// maxRefreshBody - largest /auth/refresh body accepted, a refresh token is well below it
+const maxRefreshBody = 1024
+
+// refreshTokenFormat - characters and length of a heroku refresh token
+var refreshTokenFormat = regexp.MustCompile(`^[A-Za-z0-9._~+/=-]{1,512}$`)
+
+// refreshLimits - the relay holds otter's client secret, so refreshes are limited per client ip
+// and per refresh token to keep it from being used as an open proxy against the oauth client
+var refreshLimits = struct {
+	perIP    *rateLimiter
+	perToken *rateLimiter
+}{
+	perIP:    newRateLimiter(30, time.Minute),
+	perToken: newRateLimiter(5, time.Minute),
+}
+
+// refreshRequest - the only body /auth/refresh accepts
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// errRefreshBody - why a refresh body was rejected, safe to send back to the client
+type errRefreshBody struct {
+	status  int
+	message string
+}
+
+func (e *errRefreshBody) Error() string {
+	return e.message
+}
+
+// decodeRefreshRequest - strictly validate a refresh body: a single json object with a
+// well-formed refresh_token and nothing else
+func decodeRefreshRequest(r *http.Request) (*refreshRequest, error) {
+	// older clis don't send a content type
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "application/json" {
+			return nil, &errRefreshBody{http.StatusUnsupportedMediaType, "content type must be application/json"}
+		}
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRefreshBody+1))
+	if err != nil {
+		return nil, &errRefreshBody{http.StatusBadRequest, "couldn't read request body"}
+	}
+
+	if len(b) > maxRefreshBody {
+		return nil, &errRefreshBody{http.StatusRequestEntityTooLarge, "request body too large"}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	var body refreshRequest
+	if err := dec.Decode(&body); err != nil {
+		return nil, &errRefreshBody{http.StatusBadRequest, "invalid request body - expected {\"refresh_token\": \"...\"}"}
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &errRefreshBody{http.StatusBadRequest, "invalid request body - trailing data"}
+	}
+
+	if !refreshTokenFormat.MatchString(body.RefreshToken) {
+		return nil, &errRefreshBody{http.StatusBadRequest, "invalid refresh_token"}
+	}
+
+	return &body, nil
+}
+
+// handleRefreshToken - refresh the cli's tokens with otter's client secret. Every attempt is
+// audit logged with the client ip and a fingerprint of the refresh token.
+func handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	audit := logFields{"audit": true, "ip": clientIP(r)}
+
+	// auditRefresh - log the outcome of the attempt and count it
+	auditRefresh := func(level, result string) {
+		audit["result"] = result
+		metrics.refreshes.inc(result)
+		logEvent(level, "refresh attempt", audit)
+	}
+
+	if ok, retry := refreshLimits.perIP.allow(clientIP(r)); !ok {
+		auditRefresh("warn", "rate_limited")
+		tooManyRequests(w, retry, "too many refresh attempts - try again later")
+		return
+	}
+
+	body, err := decodeRefreshRequest(r)
+	if err != nil {
+		auditRefresh("warn", "invalid")
+
+		status := http.StatusBadRequest
+		var invalid *errRefreshBody
+		if errors.As(err, &invalid) {
+			status = invalid.status
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(body.RefreshToken))
+	fingerprint := hex.EncodeToString(sum[:])
+	audit["token_fingerprint"] = fingerprint[:16]
+
+	if ok, retry := refreshLimits.perToken.allow(fingerprint); !ok {
+		auditRefresh("warn", "rate_limited")
+		tooManyRequests(w, retry, "too many refresh attempts - try again later")
+		return
+	}
+
+	d := url.Values{}
+	d.Set("grant_type", "refresh_token")
+	d.Set("refresh_token", body.RefreshToken)
+	d.Set("client_secret", config.OauthSecret)
+
+	status, b, err := requestToken(d)
+	if err != nil {
+		audit["error"] = err.Error()
+		auditRefresh("error", "failed")
+		http.Error(w, errors.New("authentication failed").Error(), http.StatusBadGateway)
+		return
+	}
+
+	// heroku refuses revoked, expired or unknown refresh tokens with a 4xx: the cli has to log in
+	// again. Anything else is heroku failing, not the client.
+	if status >= 400 && status < 500 {
+		audit["upstream_status"] = status
+		auditRefresh("warn", "rejected")
+		http.Error(w, "refresh token rejected - log in again", http.StatusUnauthorized)
+		return
+	}
+
+	if status != 200 {
+		audit["upstream_status"] = status
+		auditRefresh("error", "failed")
+		http.Error(w, errors.New("authentication failed").Error(), http.StatusBadGateway)
+		return
+	}
+
+	var tokenData map[string]interface{}
+
+	if err := json.Unmarshal(b, &tokenData); err != nil || tokenData["access_token"] == nil {
+		auditRefresh("error", "failed")
+		http.Error(w, errors.New("authorization failed").Error(), http.StatusBadGateway)
+		return
+	}
+
+	auditRefresh("info", "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// tooManyRequests - reject a rate limited request
+// [retry] - time until the limit resets
+// [message] - what the client did too often
+func tooManyRequests(w http.ResponseWriter, retry time.Duration, message string) {
+	setRetryAfter(w, retry)
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// setRetryAfter - tell a rate limited client when to come back, in whole seconds
+func setRetryAfter(w http.ResponseWriter, retry time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retry.Seconds()))))
+}
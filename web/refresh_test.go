@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	succeed = "✓"
+	failed  = "✗"
+)
+
+// refresh - post a body to /auth/refresh from an ip
+func refresh(ip, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(body))
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, "+ip)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rec := httptest.NewRecorder()
+	handleRefreshToken(rec, req)
+
+	return rec
+}
+
+func TestRefreshToken(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","expires_in":28800}`))
+	}))
+	defer upstream.Close()
+
+	config = &envConfig{IDURL: upstream.URL, OauthSecret: "secret"}
+
+	var logs bytes.Buffer
+	logger.out = &logs
+
+	reset := func() {
+		refreshLimits.perIP = newRateLimiter(30, time.Minute)
+		refreshLimits.perToken = newRateLimiter(5, time.Minute)
+		logs.Reset()
+	}
+
+	t.Log("Should reject malformed bodies before contacting heroku")
+	{
+		reset()
+
+		cases := []struct {
+			contentType, body string
+			status            int
+		}{
+			{"application/json", `{"refresh_token":"` + strings.Repeat("a", 2048) + `"}`, http.StatusRequestEntityTooLarge},
+			{"application/json", `{"refresh_token":"rt","grant_type":"password"}`, http.StatusBadRequest},
+			{"application/json", `{"refresh_token":"rt"} {"refresh_token":"rt"}`, http.StatusBadRequest},
+			{"application/json", `{"refresh_token":42}`, http.StatusBadRequest},
+			{"application/json", `{"refresh_token":"rt\n"}`, http.StatusBadRequest},
+			{"text/plain", `{"refresh_token":"rt"}`, http.StatusUnsupportedMediaType},
+		}
+
+		for _, c := range cases {
+			if rec := refresh("198.51.100.1", c.contentType, c.body); rec.Code != c.status {
+				t.Fatalf("\t%s\tShould respond %d to %.40q, got %d", failed, c.status, c.body, rec.Code)
+			}
+		}
+
+		t.Logf("\t%s\tShould reject malformed bodies before contacting heroku", succeed)
+	}
+
+	t.Log("Should refresh valid requests and audit them without the token")
+	{
+		reset()
+
+		rec := refresh("198.51.100.1", "", `{"refresh_token":"valid-refresh"}`)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "new-access") {
+			t.Fatalf("\t%s\tShould refresh: %d %s", failed, rec.Code, rec.Body.String())
+		}
+
+		if strings.Contains(logs.String(), "valid-refresh") || !strings.Contains(logs.String(), `"token_fingerprint"`) || !strings.Contains(logs.String(), `"ip":"198.51.100.1"`) {
+			t.Fatalf("\t%s\tShould audit the attempt without the token:\n%s", failed, logs.String())
+		}
+
+		t.Logf("\t%s\tShould refresh valid requests and audit them without the token", succeed)
+	}
+
+	t.Log("Should rate limit attempts per refresh token")
+	{
+		reset()
+
+		for i := 0; i < 5; i++ {
+			if rec := refresh(fmt.Sprintf("198.51.100.%d", i), "application/json", `{"refresh_token":"stolen"}`); rec.Code != http.StatusOK {
+				t.Fatalf("\t%s\tShould allow attempt %d, got %d", failed, i+1, rec.Code)
+			}
+		}
+
+		rec := refresh("198.51.100.99", "application/json", `{"refresh_token":"stolen"}`)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("\t%s\tShould limit the token, got %d", failed, rec.Code)
+		}
+
+		t.Logf("\t%s\tShould rate limit attempts per refresh token", succeed)
+	}
+
+	t.Log("Should rate limit attempts per client ip")
+	{
+		reset()
+
+		for i := 0; i < 30; i++ {
+			if rec := refresh("198.51.100.1", "application/json", fmt.Sprintf(`{"refresh_token":"token-%d"}`, i)); rec.Code != http.StatusOK {
+				t.Fatalf("\t%s\tShould allow attempt %d, got %d", failed, i+1, rec.Code)
+			}
+		}
+
+		if rec := refresh("198.51.100.1", "application/json", `{"refresh_token":"another"}`); rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("\t%s\tShould limit the ip, got %d", failed, rec.Code)
+		}
+
+		if rec := refresh("198.51.100.2", "application/json", `{"refresh_token":"another"}`); rec.Code != http.StatusOK {
+			t.Fatalf("\t%s\tShould not limit other ips, got %d", failed, rec.Code)
+		}
+
+		t.Logf("\t%s\tShould rate limit attempts per client ip", succeed)
+	}
+
+	t.Log("Should tell a rejected refresh token apart from heroku failing")
+	{
+		cases := map[int]int{
+			http.StatusBadRequest:          http.StatusUnauthorized,
+			http.StatusUnauthorized:        http.StatusUnauthorized,
+			http.StatusInternalServerError: http.StatusBadGateway,
+			http.StatusServiceUnavailable:  http.StatusBadGateway,
+		}
+
+		for upstreamStatus, want := range cases {
+			reset()
+
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"id":"unauthorized"}`, upstreamStatus)
+			}))
+			config.IDURL = failing.URL
+
+			rec := refresh("198.51.100.1", "application/json", `{"refresh_token":"revoked"}`)
+			failing.Close()
+
+			if rec.Code != want {
+				t.Fatalf("\t%s\tShould answer %d to heroku's %d, got %d", failed, want, upstreamStatus, rec.Code)
+			}
+		}
+
+		config.IDURL = upstream.URL
+
+		t.Logf("\t%s\tShould tell a rejected refresh token apart from heroku failing", succeed)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// sessionTTL - how long a headless cli may take to log in and collect its tokens
+const sessionTTL = 10 * time.Minute
+
+// errTooManySessions - the relay already waits on as many logins as it keeps
+var errTooManySessions = errors.New("too many logins in progress")
+
+// pollLimit - polls per client ip, well above a cli polling every 2s. Polls don't share the refresh
+// budget, or a headless login would use it up.
+var pollLimit = newRateLimiter(120, time.Minute)
+
+// sessionID - sha256 hex digest of the secret the cli polls with
+var sessionID = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// pendingLogin - login started by a headless cli, tokens are nil until the user authorizes otter
+type pendingLogin struct {
+	tokens  map[string]interface{}
+	expires time.Time
+}
+
+// sessionStore - headless logins by session id. The cli only ever sends the hash of its secret
+// in the login url, so a leaked url can't be used to collect the tokens.
+type sessionStore struct {
+	max int
+
+	mu        sync.Mutex
+	logins    map[string]*pendingLogin
+	lastPurge time.Time
+}
+
+var sessions = newSessionStore(10000)
+
+// newSessionStore - keep at most max logins at once
+func newSessionStore(max int) *sessionStore {
+	return &sessionStore{max: max, logins: map[string]*pendingLogin{}}
+}
+
+// start - register a login waiting for tokens, errTooManySessions once the store is full
+// [id] - session id sent in the login url
+func (s *sessionStore) start(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) > time.Minute || len(s.logins) >= s.max {
+		s.purge(now)
+	}
+
+	if _, ok := s.logins[id]; ok {
+		return nil
+	}
+
+	if len(s.logins) >= s.max {
+		return errTooManySessions
+	}
+
+	s.logins[id] = &pendingLogin{expires: now.Add(sessionTTL)}
+	return nil
+}
+
+// complete - hand tokens to a waiting login, false when it's unknown or expired
+// [id] - session id from the session cookie
+// [tokens] - tokens to deliver to the cli
+func (s *sessionStore) complete(id string, tokens map[string]interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.logins[id]
+	if !ok || login.tokens != nil || time.Now().After(login.expires) {
+		return false
+	}
+
+	login.tokens = tokens
+	return true
+}
+
+// poll - tokens of a completed login, handed out only once. An unknown session is merely
+// pending: the cli may poll before the user opens the login url, which starts it.
+// [id] - session id derived from the secret the cli polls with
+func (s *sessionStore) poll(id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.logins[id]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(login.expires) {
+		delete(s.logins, id)
+		return nil
+	}
+
+	if login.tokens != nil {
+		delete(s.logins, id)
+	}
+
+	return login.tokens
+}
+
+// purge - drop expired logins, callers hold the lock
+func (s *sessionStore) purge(now time.Time) {
+	for id, login := range s.logins {
+		if now.After(login.expires) {
+			delete(s.logins, id)
+		}
+	}
+	s.lastPurge = now
+}
+
+// handlePollSession - headless clis poll with their session secret until the user has logged in.
+// Responds 202 while pending and 200 with the tokens, which are handed out once.
+func handlePollSession(w http.ResponseWriter, r *http.Request) {
+	if ok, retry := pollLimit.allow(clientIP(r)); !ok {
+		tooManyRequests(w, retry, "polling too often - try again later")
+		return
+	}
+
+	var body struct {
+		Secret string `json:"session_secret"`
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil || body.Secret == "" {
+		http.Error(w, "missing session_secret", http.StatusBadRequest)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(body.Secret))
+	tokens := sessions.poll(hex.EncodeToString(sum[:]))
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if tokens == nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "pending"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	config = &envConfig{IDURL: ID_URL, OauthClientID: "client", OauthSecret: "secret"}
+	logger.out = ioutil.Discard
+
+	defer func(s *sessionStore, l *rateLimiter) { sessions, pollLimit = s, l }(sessions, pollLimit)
+
+	// poll - ask for the tokens of a session secret from a client ip
+	poll := func(ip, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/auth/session", strings.NewReader(`{"session_secret":"`+secret+`"}`))
+		req.Header.Set("X-Forwarded-For", ip)
+
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Log("Should answer polls for unknown sessions without keeping them")
+	{
+		sessions = newSessionStore(10)
+		pollLimit = newRateLimiter(120, time.Minute)
+
+		for i := 0; i < 20; i++ {
+			if rec := poll("198.51.100.1", strings.Repeat("s", i+1)); rec.Code != http.StatusAccepted {
+				t.Fatalf("\t%s\tShould be pending: %d", failed, rec.Code)
+			}
+		}
+
+		if len(sessions.logins) != 0 {
+			t.Fatalf("\t%s\tShould not store polled sessions: %d", failed, len(sessions.logins))
+		}
+
+		t.Logf("\t%s\tShould answer polls for unknown sessions without keeping them", succeed)
+	}
+
+	t.Log("Should hand the tokens of a started login to its poller once")
+	{
+		sum := sha256.Sum256([]byte("secret"))
+		id := hex.EncodeToString(sum[:])
+
+		if err := sessions.start(id); err != nil || !sessions.complete(id, map[string]interface{}{"access_token": "access"}) {
+			t.Fatalf("\t%s\tShould complete the login: %v", failed, err)
+		}
+
+		if rec := poll("198.51.100.1", "secret"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "access") {
+			t.Fatalf("\t%s\tShould hand out the tokens: %d", failed, rec.Code)
+		}
+
+		if rec := poll("198.51.100.1", "secret"); rec.Code != http.StatusAccepted {
+			t.Fatalf("\t%s\tShould hand out the tokens once: %d", failed, rec.Code)
+		}
+
+		t.Logf("\t%s\tShould hand the tokens of a started login to its poller once", succeed)
+	}
+
+	t.Log("Should refuse new logins once the store is full")
+	{
+		sessions = newSessionStore(2)
+
+		for i := 0; i < 2; i++ {
+			if err := sessions.start(strings.Repeat(string(rune('a'+i)), 64)); err != nil {
+				t.Fatalf("\t%s\tShould start the login: %v", failed, err)
+			}
+		}
+
+		if err := sessions.start(strings.Repeat("c", 64)); err != errTooManySessions {
+			t.Fatalf("\t%s\tShould refuse the login: %v", failed, err)
+		}
+
+		if err := sessions.start(strings.Repeat("a", 64)); err != nil {
+			t.Fatalf("\t%s\tShould still accept a login it already has: %v", failed, err)
+		}
+
+		if rec := get("/auth?session=" + strings.Repeat("c", 64)); rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("\t%s\tShould turn the browser away: %d", failed, rec.Code)
+		}
+
+		t.Logf("\t%s\tShould refuse new logins once the store is full", succeed)
+	}
+
+	t.Log("Should limit polls per client ip")
+	{
+		pollLimit = newRateLimiter(2, time.Minute)
+
+		poll("198.51.100.2", "secret")
+		poll("198.51.100.2", "secret")
+
+		rec := poll("198.51.100.2", "secret")
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("\t%s\tShould rate limit the client: %d", failed, rec.Code)
+		}
+
+		if rec := poll("198.51.100.3", "secret"); rec.Code != http.StatusAccepted {
+			t.Fatalf("\t%s\tShould not limit other clients: %d", failed, rec.Code)
+		}
+
+		t.Logf("\t%s\tShould limit polls per client ip", succeed)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// stateCookie - ties the oauth state to the browser that started the login
+const stateCookie = "otter_state"
+
+// stateTTL - how long a user may take to authorize otter on heroku
+const stateTTL = 10 * time.Minute
+
+// errStateInvalid - the state is unknown, expired or was already used
+var errStateInvalid = errors.New("this login link has expired or was already used")
+
+// errTooManyStates - the relay already keeps as many logins in progress as it may
+var errTooManyStates = errors.New("too many logins in progress")
+
+// loginLimit - logins started per client ip, every one of them keeps a state and a session
+var loginLimit = newRateLimiter(30, time.Minute)
+
+// cliSession - cli a login belongs to: the session its tokens are handed to, the loopback
+// host and port of its callback server, zero for headless logins, and the scopes it asked for
+type cliSession struct {
+	host    string
+	port    int
+	session string
+	scope   string
+}
+
+// pendingState - oauth state minted by /auth
+type pendingState struct {
+	cli     cliSession
+	expires time.Time
+}
+
+// stateStore - oauth states of logins in progress, each one usable once
+type stateStore struct {
+	max int
+
+	mu        sync.Mutex
+	states    map[string]*pendingState
+	lastPurge time.Time
+}
+
+var states = newStateStore(10000)
+
+// newStateStore - keep at most max states at once
+func newStateStore(max int) *stateStore {
+	return &stateStore{max: max, states: map[string]*pendingState{}}
+}
+
+// mint - random state for a new login, errTooManyStates once the store is full
+// [cli] - cli session the login belongs to
+func (s *stateStore) mint(cli cliSession) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) > time.Minute || len(s.states) >= s.max {
+		s.purge(now)
+	}
+
+	if len(s.states) >= s.max {
+		return "", errTooManyStates
+	}
+
+	s.states[state] = &pendingState{cli: cli, expires: now.Add(stateTTL)}
+
+	return state, nil
+}
+
+// consume - cli session of a state, which can't be used again
+// [state] - state heroku sent back to the callback
+func (s *stateStore) consume(state string) (cliSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, ok := s.states[state]
+	if !ok {
+		return cliSession{}, errStateInvalid
+	}
+
+	delete(s.states, state)
+	if time.Now().After(pending.expires) {
+		return cliSession{}, errStateInvalid
+	}
+
+	return pending.cli, nil
+}
+
+// purge - drop expired states, callers hold the lock
+func (s *stateStore) purge(now time.Time) {
+	for state, pending := range s.states {
+		if now.After(pending.expires) {
+			delete(s.states, state)
+		}
+	}
+	s.lastPurge = now
+}
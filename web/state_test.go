@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStates(t *testing.T) {
+	config = &envConfig{IDURL: ID_URL, OauthClientID: "client", OauthSecret: "secret"}
+	logger.out = ioutil.Discard
+
+	defer func(s *stateStore, l *rateLimiter) { states, loginLimit = s, l }(states, loginLimit)
+
+	session := strings.Repeat("b", 64)
+
+	t.Log("Should refuse new logins once the store is full")
+	{
+		states = newStateStore(2)
+		loginLimit = newRateLimiter(30, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			if rec := get("/auth?session=" + session); rec.Code != http.StatusOK {
+				t.Fatalf("\t%s\tShould start the login: %d", failed, rec.Code)
+			}
+		}
+
+		if rec := get("/auth?session=" + session); rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("\t%s\tShould turn the browser away: %d", failed, rec.Code)
+		}
+
+		if _, err := states.mint(cliSession{session: session}); err != errTooManyStates {
+			t.Fatalf("\t%s\tShould not mint another state: %v", failed, err)
+		}
+
+		t.Logf("\t%s\tShould refuse new logins once the store is full", succeed)
+	}
+
+	t.Log("Should limit logins per client ip")
+	{
+		states = newStateStore(100)
+		loginLimit = newRateLimiter(2, time.Minute)
+
+		get("/auth?session=" + session)
+		get("/auth?session=" + session)
+
+		rec := get("/auth?session=" + session)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("\t%s\tShould rate limit the client: %d", failed, rec.Code)
+		}
+
+		if len(states.states) != 2 {
+			t.Fatalf("\t%s\tShould not mint a state for a limited client: %d", failed, len(states.states))
+		}
+
+		t.Logf("\t%s\tShould limit logins per client ip", succeed)
+	}
+
+	t.Log("Should only send the browser back to a loopback callback")
+	{
+		states = newStateStore(100)
+		loginLimit = newRateLimiter(30, time.Minute)
+
+		cases := map[string]cliSession{
+			"":                   {host: "127.0.0.1", port: 7070},
+			"&host=localhost":    {host: "localhost", port: 7070},
+			"&host=::1":          {host: "::1", port: 7070},
+			"&host=evil.example": {},
+			"&host=192.168.1.10": {},
+			"&host=0.0.0.0":      {},
+		}
+
+		for query, want := range cases {
+			rec := get("/auth?port=7070&session=" + session + query)
+
+			var cli cliSession
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == stateCookie {
+					cli, _ = states.consume(c.Value)
+				}
+			}
+
+			if cli.host != want.host || cli.port != want.port {
+				t.Fatalf("\t%s\tShould call back %v for %q, got %v", failed, want, query, cli)
+			}
+		}
+
+		t.Logf("\t%s\tShould only send the browser back to a loopback callback", succeed)
+	}
+}